@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessKeySpec defines the desired state of AccessKey
+type AccessKeySpec struct {
+	// Reference to User resource in the same namespace which owns the access key.
+	UserRef corev1.LocalObjectReference `json:"userRef"`
+	// Secret name where to store access credentials. If not set - <name>-minio-accesskey will be used.
+	// Secret contains: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+	SecretName string `json:"secretName,omitempty"`
+	// Inline session policy (IAM policy JSON) which restricts permissions of the key.
+	// If not set - key inherits all permissions of the user.
+	Policy string `json:"policy,omitempty"`
+	// Time after which key will be revoked. Resource is kept with Expired condition.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+const (
+	AccessKeyConditionCreated       = "accessKeyCreated"
+	AccessKeyConditionSecretCreated = "accessKeySecretCreated"
+	AccessKeyConditionExpired       = "accessKeyExpired"
+)
+
+// AccessKeyStatus defines the observed state of AccessKey
+type AccessKeyStatus struct {
+	// Access key (service account) in MinIO.
+	AccessKey  string             `json:"accessKey,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Fingerprint of credentials set in MinIO. Secret key is updated only if fingerprint changed.
+	CredentialsFingerprint string `json:"credentialsFingerprint,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// AccessKey is the Schema for the accesskeys API
+type AccessKey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AccessKeySpec   `json:"spec,omitempty"`
+	Status AccessKeyStatus `json:"status,omitempty"`
+}
+
+// SecretName returns name of secret with credentials. Default differs from User secret, so resources with the same
+// name do not share a secret.
+func (in *AccessKey) SecretName() string {
+	if in.Spec.SecretName != "" {
+		return in.Spec.SecretName
+	}
+	return in.Name + "-minio-accesskey"
+}
+
+//+kubebuilder:object:root=true
+
+// AccessKeyList contains a list of AccessKey
+type AccessKeyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AccessKey `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessKey{}, &AccessKeyList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -39,10 +40,13 @@ const (
 // BucketStatus defines the observed state of Bucket
 type BucketStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 
 // Bucket is the Schema for the buckets API
 type Bucket struct {
@@ -53,6 +57,16 @@ type Bucket struct {
 	Status BucketStatus `json:"status,omitempty"`
 }
 
+// BucketName is bucket name in MinIO.
+func (in *Bucket) BucketName() string {
+	return in.Name
+}
+
+// IsReady returns true if bucket created in MinIO.
+func (in *Bucket) IsReady() bool {
+	return meta.IsStatusConditionTrue(in.Status.Conditions, BucketConditionCreated)
+}
+
 //+kubebuilder:object:root=true
 
 // BucketList contains a list of Bucket
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GroupSpec defines the desired state of Group
+type GroupSpec struct {
+	// Members of group: references to User resources in the same namespace.
+	Members []corev1.LocalObjectReference `json:"members,omitempty"`
+	// Selector over User resources in the same namespace. Matched users are added to the group
+	// in addition to Members.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Names of canned policies in MinIO attached to the group (ex: readonly). Should be allowed by namespace rules
+	// if they are enforced. Policy resources with groupRef are attached automatically.
+	Policies []string `json:"policies,omitempty"`
+	// Disable group in MinIO. Members lose permissions granted by the group.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+const (
+	GroupConditionCreated        = "groupCreated"
+	GroupConditionPolicyAssigned = "groupPolicyAssigned"
+)
+
+// GroupStatus defines the observed state of Group
+type GroupStatus struct {
+	// Name of group in MinIO. Assigned once and kept for the whole lifetime of the resource.
+	Name string `json:"name,omitempty"`
+	// Access keys of current members.
+	Members    []string           `json:"members,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// Group is the Schema for the groups API
+type Group struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GroupSpec   `json:"spec,omitempty"`
+	Status GroupStatus `json:"status,omitempty"`
+}
+
+// IsReady returns true if group created in MinIO.
+func (in *Group) IsReady() bool {
+	return in.Status.Name != "" && meta.IsStatusConditionTrue(in.Status.Conditions, GroupConditionCreated)
+}
+
+//+kubebuilder:object:root=true
+
+// GroupList contains a list of Group
+type GroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Group `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Group{}, &GroupList{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnyNamespace matches all namespaces in namespace lists.
+const AnyNamespace = "*"
+
+// ConditionAuthorized is set on every managed resource when namespace rules are enforced.
+const ConditionAuthorized = "authorized"
+
+// ResyncAnnotation overrides period of checking the resource in MinIO (Go duration, ex: 10m).
+const ResyncAnnotation = "minio.k8s.reddec.net/resync-period"
+
+// PausedAnnotation stops all changes in MinIO for the resource (including removal) if set to "true".
+const PausedAnnotation = "minio.k8s.reddec.net/paused"
+
+// ConditionPaused is true while changes in MinIO are paused for the resource.
+const ConditionPaused = "paused"
+
+// ConditionDriftDetected is true if out-of-band changes in MinIO were found and reverted by the last reconcile.
+const ConditionDriftDetected = "driftDetected"
+
+// DryRunAnnotation makes the operator only plan changes in MinIO for the resource if set to "true".
+const DryRunAnnotation = "minio.k8s.reddec.net/dry-run"
+
+// ConditionDryRun is true while changes in MinIO are only planned for the resource.
+const ConditionDryRun = "dryRun"
+
+// AdoptAnnotation is name of existing canned policy (for Policy) or group (for Group) in MinIO taken over by
+// the resource instead of name from template. Used only when the name is assigned. Built-in canned policies of MinIO
+// can not be adopted.
+const AdoptAnnotation = "minio.k8s.reddec.net/adopt"
+
+// OperatorConfigSpec defines the desired state of OperatorConfig
+type OperatorConfigSpec struct {
+	// Rules for namespaces. Namespace without matched rule can not use operator.
+	// If several rules are matched, permissions are combined.
+	Rules []NamespaceRule `json:"rules,omitempty"`
+}
+
+// NamespaceRule defines permissions for matched namespaces.
+type NamespaceRule struct {
+	// Names of namespaces. Use * for all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Namespaces selected by labels.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Allow creating buckets.
+	Buckets bool `json:"buckets,omitempty"`
+	// Allowed prefixes of bucket names for buckets and policies. If not set - any name allowed.
+	BucketPrefixes []string `json:"bucketPrefixes,omitempty"`
+	// Allowed MinIO connections. If not set - any connection allowed.
+	Connections []string `json:"connections,omitempty"`
+	// Canned policies in MinIO which groups may attach by name (spec.policies of Group). If not set - only Policy
+	// resources can be attached.
+	Policies []string `json:"policies,omitempty"`
+	// Name prefixes of existing canned policies and groups in MinIO which may be taken over by AdoptAnnotation.
+	// If not set - adoption is not allowed. Built-in canned policies can not be adopted.
+	AdoptPrefixes []string `json:"adoptPrefixes,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// OperatorConfig is the Schema for the operatorconfigs API
+type OperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec OperatorConfigSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OperatorConfigList contains a list of OperatorConfig
+type OperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{}, &OperatorConfigList{})
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,24 +27,39 @@ import (
 
 // PolicySpec defines the desired state of Policy
 type PolicySpec struct {
-	// User name (client_id)
-	User string `json:"user"`
-	// Bucket to access
-	Bucket string `json:"bucket"`
+	// User name (client_id). Ignored if UserRef is set.
+	User string `json:"user,omitempty"`
+	// Reference to User resource in the same namespace. Policy is applied once user is created.
+	UserRef *corev1.LocalObjectReference `json:"userRef,omitempty"`
+	// Reference to Group resource in the same namespace. If set, policy is attached to the group instead of user.
+	GroupRef *corev1.LocalObjectReference `json:"groupRef,omitempty"`
+	// Bucket to access. Ignored if BucketRef is set.
+	Bucket string `json:"bucket,omitempty"`
+	// Reference to Bucket resource in the same namespace. Policy is applied once bucket is created.
+	BucketRef *corev1.LocalObjectReference `json:"bucketRef,omitempty"`
 	// Read permissions
 	Read bool `json:"read,omitempty"`
 	// Write permissions
 	Write bool `json:"write,omitempty"`
 }
 
+const (
+	PolicyConditionCreated  = "policyCreated"
+	PolicyConditionAssigned = "policyAssigned"
+)
+
 // PolicyStatus defines the observed state of Policy
 type PolicyStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Name of canned policy in MinIO. Assigned once and kept for the whole lifetime of the resource.
+	Name       string             `json:"name,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 
 // Policy is the Schema for the policies API
 type Policy struct {
@@ -53,6 +70,11 @@ type Policy struct {
 	Status PolicyStatus `json:"status,omitempty"`
 }
 
+// IsCreated returns true if canned policy created in MinIO.
+func (in *Policy) IsCreated() bool {
+	return in.Status.Name != "" && meta.IsStatusConditionTrue(in.Status.Conditions, PolicyConditionCreated)
+}
+
 //+kubebuilder:object:root=true
 
 // PolicyList contains a list of Policy
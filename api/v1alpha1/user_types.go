@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,22 +27,111 @@ import (
 // UserSpec defines the desired state of User
 type UserSpec struct {
 	// Secret name where to store access credentials. If not set - <name>-minio will be used.
-	// Secret contains: AWS_ACCESS_KEY_ID (which is equal to <name>), AWS_SECRET_ACCESS_KEY
+	// Secret contains: AWS_ACCESS_KEY_ID (user name in MinIO), AWS_SECRET_ACCESS_KEY
 	SecretName string `json:"secretName,omitempty"`
+	// User name (access key) in MinIO. If not set - operator-level template is used (default: <namespace>-<name>).
+	// Can not be changed after creation.
+	AccessKey string `json:"accessKey,omitempty"`
+	// Periodical rotation of credentials. Can not be used with CredentialsFrom.
+	Rotation *Rotation `json:"rotation,omitempty"`
+	// Use externally provided credentials from secret instead of generated. Operator only reads the secret.
+	CredentialsFrom *CredentialsSource `json:"credentialsFrom,omitempty"`
+	// Additional keys in secret rendered as Go templates. Available fields: .AccessKey, .SecretKey, .Endpoint,
+	// .URL, .Host, .Region, .Secure, .Buckets (from attached policies). Default keys can not be overridden.
+	SecretTemplate map[string]string `json:"secretTemplate,omitempty"`
+	// Ready-to-use client configuration files added to secret:
+	// aws - `credentials` and `config` (mount as ~/.aws), rclone - `rclone.conf` with remote `minio`,
+	// mc - `config.json` with alias `minio` (mount as ~/.mc).
+	SecretFormats []SecretFormat `json:"secretFormats,omitempty"`
+	// Copies of credentials secret in other namespaces (or with other names). Namespaces should be allowed
+	// by operator. Copies are kept in sync and removed with the user.
+	SecretTargets []SecretTarget `json:"secretTargets,omitempty"`
+	// Disable user in MinIO. Secret and policies are kept.
+	Disabled bool `json:"disabled,omitempty"`
+	// Disable user till the specified time.
+	SuspendUntil *metav1.Time `json:"suspendUntil,omitempty"`
 }
 
+// SecretFormat is format of client configuration file in user secret.
+// +kubebuilder:validation:Enum=aws;rclone;mc
+type SecretFormat string
+
+const (
+	SecretFormatAWS    SecretFormat = "aws"
+	SecretFormatRclone SecretFormat = "rclone"
+	SecretFormatMC     SecretFormat = "mc"
+)
+
+// SecretTarget is location of credentials secret copy.
+type SecretTarget struct {
+	// Namespace of secret. If not set - namespace of the user is used.
+	Namespace string `json:"namespace,omitempty"`
+	// Name of secret.
+	Name string `json:"name"`
+}
+
+// CredentialsSource is reference to secret with user credentials.
+type CredentialsSource struct {
+	// Secret name in the same namespace.
+	Name string `json:"name"`
+	// Key with secret key. Default is AWS_SECRET_ACCESS_KEY.
+	SecretKeyKey string `json:"secretKeyKey,omitempty"`
+	// Key with access key. If set, value should be equal to user name. By default, it is not checked.
+	AccessKeyKey string `json:"accessKeyKey,omitempty"`
+}
+
+// Rotation of user credentials. Either Interval or Schedule should be set.
+type Rotation struct {
+	// Interval between rotations (ex: 720h).
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Cron expression (ex: "0 3 * * 0"). Ignored if Interval is set.
+	Schedule string `json:"schedule,omitempty"`
+	// Grace period for previous credentials. If set, secret contains credentials of service account (access key) of
+	// the user instead of user credentials. Each rotation issues new access key and previous one is revoked after
+	// the grace period, so old and new credentials are both valid during the period.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// IssuedKey is access key issued for user in grace mode.
+type IssuedKey struct {
+	AccessKey string `json:"accessKey"`
+	// Time when key will be revoked. Not set for current key.
+	RevokeAt *metav1.Time `json:"revokeAt,omitempty"`
+}
+
+// RotateAnnotation forces credentials rotation when value of the annotation changes (ex: current timestamp).
+const RotateAnnotation = "minio.k8s.reddec.net/rotate"
+
 const (
 	UserConditionCreated       = "userCreated"
 	UserConditionSecretCreated = "userSecretCreated"
+	UserConditionEnabled       = "userEnabled"
 )
 
 // UserStatus defines the observed state of User
 type UserStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+	// Resolved user name (access key) in MinIO. Assigned once and kept for the whole lifetime of the resource.
+	AccessKey string `json:"accessKey,omitempty"`
+	// Time of last credentials rotation (or creation).
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
+	// Copies of credentials secret made by operator.
+	SecretCopies []SecretTarget `json:"secretCopies,omitempty"`
+	// Targets skipped because secret with the same name exists and it is not a copy of the user secret.
+	SecretConflicts []SecretTarget `json:"secretConflicts,omitempty"`
+	// Last handled value of rotate annotation.
+	RotationRequest string `json:"rotationRequest,omitempty"`
+	// Access keys issued in rotation grace mode. Current key is the one without revocation time.
+	IssuedKeys []IssuedKey `json:"issuedKeys,omitempty"`
+	// Fingerprint of credentials set in MinIO. Credentials are updated only if fingerprint changed.
+	CredentialsFingerprint string `json:"credentialsFingerprint,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 
 // User is the Schema for the users API
 type User struct {
@@ -52,6 +142,24 @@ type User struct {
 	Status UserStatus `json:"status,omitempty"`
 }
 
+// AccessKey is user name in MinIO.
+func (in *User) AccessKey() string {
+	if in.Status.AccessKey != "" {
+		return in.Status.AccessKey
+	}
+	return in.Name
+}
+
+// IsReady returns true if user created in MinIO.
+func (in *User) IsReady() bool {
+	return meta.IsStatusConditionTrue(in.Status.Conditions, UserConditionCreated)
+}
+
+// GraceMode returns true if credentials are rotated with grace period.
+func (in *User) GraceMode() bool {
+	return in.Spec.CredentialsFrom == nil && in.Spec.Rotation != nil && in.Spec.Rotation.GracePeriod != nil
+}
+
 func (in *User) SecretName() string {
 	if in.Spec.SecretName != "" {
 		return in.Spec.SecretName
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this Bucket to the Hub version (v1alpha1).
+func (src *Bucket) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Bucket)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Public = src.Spec.Access == BucketAccessPublicRead
+	dst.Spec.Retain = src.Spec.DeletionPolicy == DeletionPolicyRetain
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.Plan = src.Status.Plan
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *Bucket) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Bucket)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Access = BucketAccessPrivate
+	if src.Spec.Public {
+		dst.Spec.Access = BucketAccessPublicRead
+	}
+	dst.Spec.DeletionPolicy = DeletionPolicyDelete
+	if src.Spec.Retain {
+		dst.Spec.DeletionPolicy = DeletionPolicyRetain
+	}
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.Plan = src.Status.Plan
+	return nil
+}
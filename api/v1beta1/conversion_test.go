@@ -0,0 +1,162 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+var (
+	testMeta = metav1.ObjectMeta{Namespace: "default", Name: "app", Labels: map[string]string{"app": "demo"}}
+	testTime = metav1.NewTime(time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC))
+	testRef  = &corev1.LocalObjectReference{Name: "ref"}
+	testCond = []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Created", LastTransitionTime: testTime}}
+)
+
+func TestBucketConversion(t *testing.T) {
+	spokes := []BucketSpec{
+		{Access: BucketAccessPrivate, DeletionPolicy: DeletionPolicyDelete},
+		{Access: BucketAccessPublicRead, DeletionPolicy: DeletionPolicyRetain},
+	}
+	for _, spec := range spokes {
+		src := &Bucket{ObjectMeta: testMeta, Spec: spec, Status: BucketStatus{Conditions: testCond, Plan: []string{"create bucket"}}}
+		var hub v1alpha1.Bucket
+		var dst Bucket
+		if err := src.ConvertTo(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.ConvertFrom(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(src, &dst) {
+			t.Errorf("spoke round-trip: %+v != %+v", src.Spec, dst.Spec)
+		}
+	}
+
+	hubs := []v1alpha1.BucketSpec{{}, {Public: true}, {Retain: true}, {Public: true, Retain: true}}
+	for _, spec := range hubs {
+		src := &v1alpha1.Bucket{ObjectMeta: testMeta, Spec: spec, Status: v1alpha1.BucketStatus{Conditions: testCond}}
+		var spoke Bucket
+		var dst v1alpha1.Bucket
+		if err := spoke.ConvertFrom(src); err != nil {
+			t.Fatal(err)
+		}
+		if err := spoke.ConvertTo(&dst); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(src, &dst) {
+			t.Errorf("hub round-trip: %+v != %+v", src.Spec, dst.Spec)
+		}
+	}
+}
+
+func TestUserConversion(t *testing.T) {
+	interval := &metav1.Duration{Duration: 720 * time.Hour}
+	src := &User{
+		ObjectMeta: testMeta,
+		Spec: UserSpec{
+			Name: "app",
+			Secret: UserSecret{
+				Name:     "app-credentials",
+				Template: map[string]string{"URL": "{{.URL}}"},
+				Formats:  []SecretFormat{"aws", "mc"},
+				Targets:  []SecretTarget{{Namespace: "web", Name: "app-minio"}},
+			},
+			Rotation:     &Rotation{Interval: interval, Schedule: "0 3 * * 0", GracePeriod: interval},
+			Disabled:     true,
+			SuspendUntil: &testTime,
+		},
+		Status: UserStatus{
+			Conditions:             testCond,
+			Name:                   "app",
+			LastRotated:            &testTime,
+			SecretCopies:           []SecretTarget{{Namespace: "web", Name: "app-minio"}},
+			SecretConflicts:        []SecretTarget{{Namespace: "api", Name: "app-minio"}},
+			RotationRequest:        "1",
+			IssuedKeys:             []IssuedKey{{AccessKey: "old", RevokeAt: &testTime}, {AccessKey: "new"}},
+			CredentialsFingerprint: "abc",
+			Plan:                   []string{"create user app"},
+		},
+	}
+	external := &User{
+		ObjectMeta: testMeta,
+		Spec: UserSpec{
+			CredentialsFrom: &CredentialsSource{Name: "external", SecretKeyKey: "secret", AccessKeyKey: "access"},
+		},
+	}
+	for _, src := range []*User{src, external} {
+		var hub v1alpha1.User
+		var dst User
+		if err := src.ConvertTo(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if hub.Spec.AccessKey != src.Spec.Name || hub.Status.AccessKey != src.Status.Name {
+			t.Errorf("access key not converted: %q, %q", hub.Spec.AccessKey, hub.Status.AccessKey)
+		}
+		if err := dst.ConvertFrom(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(src, &dst) {
+			t.Errorf("spoke round-trip: %+v != %+v", src, &dst)
+		}
+
+		var back v1alpha1.User
+		if err := dst.ConvertTo(&back); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(&hub, &back) {
+			t.Errorf("hub round-trip: %+v != %+v", &hub, &back)
+		}
+	}
+}
+
+func TestPolicyConversion(t *testing.T) {
+	spokes := []PolicySpec{
+		{Subject: PolicySubject{User: "app"}, Grants: []Grant{{Bucket: "data", Read: true}}},
+		{Subject: PolicySubject{UserRef: testRef}, Grants: []Grant{{BucketRef: testRef, Write: true}}},
+		{Subject: PolicySubject{GroupRef: testRef}, Grants: []Grant{{Bucket: "data", Read: true, Write: true}}},
+	}
+	for _, spec := range spokes {
+		src := &Policy{ObjectMeta: testMeta, Spec: spec, Status: PolicyStatus{Name: "default-app", Conditions: testCond}}
+		var hub v1alpha1.Policy
+		var dst Policy
+		if err := src.ConvertTo(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.ConvertFrom(&hub); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(src, &dst) {
+			t.Errorf("spoke round-trip: %+v != %+v", src.Spec, dst.Spec)
+		}
+
+		var back v1alpha1.Policy
+		if err := dst.ConvertTo(&back); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(&hub, &back) {
+			t.Errorf("hub round-trip: %+v != %+v", hub.Spec, back.Spec)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this Policy to the Hub version (v1alpha1).
+func (src *Policy) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Policy)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = v1alpha1.PolicySpec{
+		User:     src.Spec.Subject.User,
+		UserRef:  src.Spec.Subject.UserRef,
+		GroupRef: src.Spec.Subject.GroupRef,
+	}
+	if len(src.Spec.Grants) > 0 {
+		grant := src.Spec.Grants[0]
+		dst.Spec.Bucket = grant.Bucket
+		dst.Spec.BucketRef = grant.BucketRef
+		dst.Spec.Read = grant.Read
+		dst.Spec.Write = grant.Write
+	}
+	dst.Status = v1alpha1.PolicyStatus(src.Status)
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *Policy) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Policy)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = PolicySpec{
+		Subject: PolicySubject{
+			User:     src.Spec.User,
+			UserRef:  src.Spec.UserRef,
+			GroupRef: src.Spec.GroupRef,
+		},
+		Grants: []Grant{{
+			Bucket:    src.Spec.Bucket,
+			BucketRef: src.Spec.BucketRef,
+			Read:      src.Spec.Read,
+			Write:     src.Spec.Write,
+		}},
+	}
+	dst.Status = PolicyStatus(src.Status)
+	return nil
+}
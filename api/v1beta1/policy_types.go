@@ -0,0 +1,89 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PolicySpec defines the desired state of Policy
+type PolicySpec struct {
+	// Subject of the policy: user or group.
+	Subject PolicySubject `json:"subject"`
+	// Access to buckets. Currently exactly one grant is supported.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=1
+	Grants []Grant `json:"grants"`
+}
+
+// PolicySubject is user or group to which policy is attached.
+type PolicySubject struct {
+	// User name (access key) in MinIO. Ignored if UserRef is set.
+	User string `json:"user,omitempty"`
+	// Reference to User resource in the same namespace. Policy is applied once user is created.
+	UserRef *corev1.LocalObjectReference `json:"userRef,omitempty"`
+	// Reference to Group resource in the same namespace. If set, policy is attached to the group instead of user.
+	GroupRef *corev1.LocalObjectReference `json:"groupRef,omitempty"`
+}
+
+// Grant is access to bucket.
+type Grant struct {
+	// Bucket to access. Ignored if BucketRef is set.
+	Bucket string `json:"bucket,omitempty"`
+	// Reference to Bucket resource in the same namespace. Policy is applied once bucket is created.
+	BucketRef *corev1.LocalObjectReference `json:"bucketRef,omitempty"`
+	// Read permissions
+	Read bool `json:"read,omitempty"`
+	// Write permissions
+	Write bool `json:"write,omitempty"`
+}
+
+// PolicyStatus defines the observed state of Policy
+type PolicyStatus struct {
+	// Name of canned policy in MinIO. Assigned once and kept for the whole lifetime of the resource.
+	Name       string             `json:"name,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:unservedversion
+
+// Policy is the Schema for the policies API
+type Policy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PolicySpec   `json:"spec,omitempty"`
+	Status PolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PolicyList contains a list of Policy
+type PolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Policy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Policy{}, &PolicyList{})
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// ConvertTo converts this User to the Hub version (v1alpha1).
+func (src *User) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.User)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = v1alpha1.UserSpec{
+		SecretName:      src.Spec.Secret.Name,
+		AccessKey:       src.Spec.Name,
+		Rotation:        (*v1alpha1.Rotation)(src.Spec.Rotation),
+		CredentialsFrom: (*v1alpha1.CredentialsSource)(src.Spec.CredentialsFrom),
+		SecretTemplate:  src.Spec.Secret.Template,
+		Disabled:        src.Spec.Disabled,
+		SuspendUntil:    src.Spec.SuspendUntil,
+	}
+	for _, format := range src.Spec.Secret.Formats {
+		dst.Spec.SecretFormats = append(dst.Spec.SecretFormats, v1alpha1.SecretFormat(format))
+	}
+	for _, target := range src.Spec.Secret.Targets {
+		dst.Spec.SecretTargets = append(dst.Spec.SecretTargets, v1alpha1.SecretTarget(target))
+	}
+	dst.Status = v1alpha1.UserStatus{
+		Conditions:             src.Status.Conditions,
+		AccessKey:              src.Status.Name,
+		LastRotated:            src.Status.LastRotated,
+		RotationRequest:        src.Status.RotationRequest,
+		CredentialsFingerprint: src.Status.CredentialsFingerprint,
+		Plan:                   src.Status.Plan,
+	}
+	for _, target := range src.Status.SecretCopies {
+		dst.Status.SecretCopies = append(dst.Status.SecretCopies, v1alpha1.SecretTarget(target))
+	}
+	for _, target := range src.Status.SecretConflicts {
+		dst.Status.SecretConflicts = append(dst.Status.SecretConflicts, v1alpha1.SecretTarget(target))
+	}
+	for _, key := range src.Status.IssuedKeys {
+		dst.Status.IssuedKeys = append(dst.Status.IssuedKeys, v1alpha1.IssuedKey(key))
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *User) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.User)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = UserSpec{
+		Name: src.Spec.AccessKey,
+		Secret: UserSecret{
+			Name:     src.Spec.SecretName,
+			Template: src.Spec.SecretTemplate,
+		},
+		Rotation:        (*Rotation)(src.Spec.Rotation),
+		CredentialsFrom: (*CredentialsSource)(src.Spec.CredentialsFrom),
+		Disabled:        src.Spec.Disabled,
+		SuspendUntil:    src.Spec.SuspendUntil,
+	}
+	for _, format := range src.Spec.SecretFormats {
+		dst.Spec.Secret.Formats = append(dst.Spec.Secret.Formats, SecretFormat(format))
+	}
+	for _, target := range src.Spec.SecretTargets {
+		dst.Spec.Secret.Targets = append(dst.Spec.Secret.Targets, SecretTarget(target))
+	}
+	dst.Status = UserStatus{
+		Conditions:             src.Status.Conditions,
+		Name:                   src.Status.AccessKey,
+		LastRotated:            src.Status.LastRotated,
+		RotationRequest:        src.Status.RotationRequest,
+		CredentialsFingerprint: src.Status.CredentialsFingerprint,
+		Plan:                   src.Status.Plan,
+	}
+	for _, target := range src.Status.SecretCopies {
+		dst.Status.SecretCopies = append(dst.Status.SecretCopies, SecretTarget(target))
+	}
+	for _, target := range src.Status.SecretConflicts {
+		dst.Status.SecretConflicts = append(dst.Status.SecretConflicts, SecretTarget(target))
+	}
+	for _, key := range src.Status.IssuedKeys {
+		dst.Status.IssuedKeys = append(dst.Status.IssuedKeys, IssuedKey(key))
+	}
+	return nil
+}
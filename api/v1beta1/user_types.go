@@ -0,0 +1,138 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UserSpec defines the desired state of User
+type UserSpec struct {
+	// User name (access key) in MinIO. If not set - operator-level template is used. Can not be changed after creation.
+	Name string `json:"name,omitempty"`
+	// Secret with credentials.
+	Secret UserSecret `json:"secret,omitempty"`
+	// Periodical rotation of credentials. Can not be used with CredentialsFrom.
+	Rotation *Rotation `json:"rotation,omitempty"`
+	// Use externally provided credentials from secret instead of generated. Operator only reads the secret.
+	CredentialsFrom *CredentialsSource `json:"credentialsFrom,omitempty"`
+	// Disable user in MinIO. Secret and policies are kept.
+	Disabled bool `json:"disabled,omitempty"`
+	// Disable user till the specified time.
+	SuspendUntil *metav1.Time `json:"suspendUntil,omitempty"`
+}
+
+// UserSecret defines secret with user credentials.
+type UserSecret struct {
+	// Secret name. If not set - <name>-minio will be used.
+	// Secret contains: AWS_ACCESS_KEY_ID (user name in MinIO), AWS_SECRET_ACCESS_KEY
+	Name string `json:"name,omitempty"`
+	// Additional keys rendered as Go templates. Available fields: .AccessKey, .SecretKey, .Endpoint,
+	// .URL, .Host, .Region, .Secure, .Buckets (from attached policies). Default keys can not be overridden.
+	Template map[string]string `json:"template,omitempty"`
+	// Ready-to-use client configuration files: aws, rclone, mc.
+	Formats []SecretFormat `json:"formats,omitempty"`
+	// Copies of the secret in other namespaces (or with other names).
+	Targets []SecretTarget `json:"targets,omitempty"`
+}
+
+// SecretFormat is format of client configuration file in user secret.
+// +kubebuilder:validation:Enum=aws;rclone;mc
+type SecretFormat string
+
+// SecretTarget is location of credentials secret copy.
+type SecretTarget struct {
+	// Namespace of secret. If not set - namespace of the user is used.
+	Namespace string `json:"namespace,omitempty"`
+	// Name of secret.
+	Name string `json:"name"`
+}
+
+// CredentialsSource is reference to secret with user credentials.
+type CredentialsSource struct {
+	// Secret name in the same namespace.
+	Name string `json:"name"`
+	// Key with secret key. Default is AWS_SECRET_ACCESS_KEY.
+	SecretKeyKey string `json:"secretKeyKey,omitempty"`
+	// Key with access key. If set, value should be equal to user name. By default, it is not checked.
+	AccessKeyKey string `json:"accessKeyKey,omitempty"`
+}
+
+// Rotation of user credentials. Either Interval or Schedule should be set.
+type Rotation struct {
+	// Interval between rotations (ex: 720h).
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Cron expression (ex: "0 3 * * 0"). Ignored if Interval is set.
+	Schedule string `json:"schedule,omitempty"`
+	// Grace period for previous credentials. Secret contains credentials of service account of the user,
+	// previous one is revoked after the period.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// IssuedKey is access key issued for user in grace mode.
+type IssuedKey struct {
+	AccessKey string `json:"accessKey"`
+	// Time when key will be revoked. Not set for current key.
+	RevokeAt *metav1.Time `json:"revokeAt,omitempty"`
+}
+
+// UserStatus defines the observed state of User
+type UserStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Resolved user name (access key) in MinIO. Assigned once and kept for the whole lifetime of the resource.
+	Name string `json:"name,omitempty"`
+	// Time of last credentials rotation (or creation).
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
+	// Copies of credentials secret made by operator.
+	SecretCopies []SecretTarget `json:"secretCopies,omitempty"`
+	// Targets skipped because secret with the same name exists and it is not a copy of the user secret.
+	SecretConflicts []SecretTarget `json:"secretConflicts,omitempty"`
+	// Last handled value of rotate annotation.
+	RotationRequest string `json:"rotationRequest,omitempty"`
+	// Access keys issued in rotation grace mode. Current key is the one without revocation time.
+	IssuedKeys []IssuedKey `json:"issuedKeys,omitempty"`
+	// Fingerprint of credentials set in MinIO. Credentials are updated only if fingerprint changed.
+	CredentialsFingerprint string `json:"credentialsFingerprint,omitempty"`
+	// Changes in MinIO planned in dry-run mode.
+	Plan []string `json:"plan,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:unservedversion
+
+// User is the Schema for the users API
+type User struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   UserSpec   `json:"spec,omitempty"`
+	Status UserStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// UserList contains a list of User
+type UserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []User `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&User{}, &UserList{})
+}
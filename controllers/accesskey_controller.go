@@ -0,0 +1,411 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/minio/madmin-go"
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+const accessKeyFinalizer = "reddec.net.k8s.minio-accesskey-finalizer"
+
+// MinIO limits service account credentials: access key up to 20 chars, secret key up to 40 chars.
+const (
+	serviceAccountKeySize    = 10
+	serviceAccountSecretSize = 20
+)
+
+const accessKeyUserRefField = ".spec.userRef.name"
+
+// errSecretNotOwned means that secret exists, but it is not controlled by the resource, so it can not be updated.
+var errSecretNotOwned = errors.New("secret is not controlled by the resource")
+
+// AccessKeyReconciler reconciles a AccessKey object
+type AccessKeyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Admin  AdminAPI
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Timings of periodic reconciliation.
+	Resync Resync
+	// Global pause. Annotation pause works without it.
+	Pause *Pause
+	// Global dry-run. Annotation dry-run works without it.
+	DryRun *DryRun
+	// Namespaces to reconcile. Nil scope allows all namespaces.
+	Scope *Scope
+}
+
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=accesskeys,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=accesskeys/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=accesskeys/finalizers,verbs=update
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.12.2/pkg/reconcile
+func (r *AccessKeyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var manifest = &miniov1alpha1.AccessKey{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: req.Name}, manifest); err != nil {
+		if errors2.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("get manifest: %w", err)
+	}
+
+	allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, r.Authorizer.CheckConnection(ctx, manifest.Namespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// pause stops all changes in MinIO, including removal
+	paused, err := r.Pause.hold(ctx, manifest, &manifest.Status.Conditions)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
+	// removal
+	if manifest.GetDeletionTimestamp() != nil {
+		logger.Info("revoking access key", "accessKey", manifest.Status.AccessKey)
+		if !allowed {
+			logger.Info("not authorized, MinIO state is kept")
+		} else if err := r.revoke(ctx, manifest.Status.AccessKey); err != nil {
+			return ctrl.Result{}, fmt.Errorf("revoke access key: %w", err)
+		}
+		controllerutil.RemoveFinalizer(manifest, accessKeyFinalizer)
+		if err := r.Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !allowed {
+		logger.Info("not authorized by namespace rules")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
+	// add finalizer
+	if !controllerutil.ContainsFinalizer(manifest, accessKeyFinalizer) {
+		controllerutil.AddFinalizer(manifest, accessKeyFinalizer)
+		if err := r.Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// expiration
+	if exp := manifest.Spec.ExpiresAt; exp != nil && !time.Now().Before(exp.Time) {
+		logger.Info("access key expired", "accessKey", manifest.Status.AccessKey)
+		if err := r.revoke(ctx, manifest.Status.AccessKey); err != nil {
+			return ctrl.Result{}, fmt.Errorf("revoke access key: %w", err)
+		}
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:   miniov1alpha1.AccessKeyConditionExpired,
+			Status: metav1.ConditionTrue,
+			Reason: "Expired",
+		})
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:   miniov1alpha1.AccessKeyConditionCreated,
+			Status: metav1.ConditionFalse,
+			Reason: "Expired",
+		})
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if manifest.Spec.Policy != "" && !json.Valid([]byte(manifest.Spec.Policy)) {
+		return ctrl.Result{}, errors.New("policy is not valid JSON")
+	}
+
+	// parent user should be created first
+	var user miniov1alpha1.User
+	if err := r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: manifest.Spec.UserRef.Name}, &user); err != nil {
+		if !errors2.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("get user: %w", err)
+		}
+	}
+	if !user.IsReady() {
+		// will be re-queued by watch on users
+		logger.Info("user not ready", "user", manifest.Spec.UserRef.Name)
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:    miniov1alpha1.AccessKeyConditionCreated,
+			Status:  metav1.ConditionFalse,
+			Reason:  "UserNotReady",
+			Message: "waiting for user " + manifest.Spec.UserRef.Name,
+		})
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// create or update secret
+	logger.Info("creating secret")
+	accessKey, secretKey, err := r.createOrUpdateSecret(ctx, manifest)
+	if errors.Is(err, errSecretNotOwned) {
+		logger.Info("secret belongs to another resource", "secret", manifest.SecretName())
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:    miniov1alpha1.AccessKeyConditionSecretCreated,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SecretConflict",
+			Message: err.Error(),
+		})
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("set secret: %w", err)
+	}
+	manifest.Status.AccessKey = accessKey
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.AccessKeyConditionSecretCreated,
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	// create or update service account
+	logger.Info("creating access key", "accessKey", accessKey)
+	if err := r.syncServiceAccount(ctx, manifest, user.AccessKey(), accessKey, secretKey); err != nil {
+		return ctrl.Result{}, fmt.Errorf("set access key: %w", err)
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.AccessKeyConditionCreated,
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	var requeue = r.Resync.after(manifest)
+	if exp := manifest.Spec.ExpiresAt; exp != nil {
+		if left := time.Until(exp.Time); left < requeue {
+			requeue = left
+		}
+	}
+	return ctrl.Result{Requeue: true, RequeueAfter: requeue}, nil
+}
+
+// syncServiceAccount creates access key or updates it only if credentials or session policy differ from MinIO.
+// Status is not saved.
+func (r *AccessKeyReconciler) syncServiceAccount(ctx context.Context, manifest *miniov1alpha1.AccessKey, user, accessKey, secretKey string) error {
+	policy := manifest.Spec.Policy
+	fingerprint := credentialsFingerprint(manifest, accessKey, secretKey)
+	info, err := r.Admin.InfoServiceAccount(ctx, accessKey)
+	if err == nil && info.ParentUser == user {
+		var update madmin.UpdateServiceAccountReq
+		if fingerprint != manifest.Status.CredentialsFingerprint {
+			update.NewSecretKey = secretKey
+		}
+		changed, err := sessionPolicyChanged(policy, info)
+		if err != nil {
+			return err
+		}
+		if changed && policy == "" {
+			// MinIO keeps current policy if new one is not set
+			update.NewPolicy = json.RawMessage(emptySessionPolicy)
+		} else if changed {
+			update.NewPolicy = json.RawMessage(policy)
+		}
+		if update.NewSecretKey == "" && update.NewPolicy == nil {
+			return nil
+		}
+		log.FromContext(ctx).Info("updating access key", "accessKey", accessKey, "credentials", update.NewSecretKey != "", "policy", changed)
+		if err := r.Admin.UpdateServiceAccount(ctx, accessKey, update); err != nil {
+			return err
+		}
+		manifest.Status.CredentialsFingerprint = fingerprint
+		return nil
+	}
+	if err == nil {
+		// parent user changed - access key can not be moved, so re-create it
+		if err := r.revoke(ctx, accessKey); err != nil {
+			return err
+		}
+	} else if !isNoSuchServiceAccount(err) {
+		return fmt.Errorf("get access key: %w", err)
+	}
+	_, err = r.Admin.AddServiceAccount(ctx, madmin.AddServiceAccountReq{
+		Policy:     json.RawMessage(policy),
+		TargetUser: user,
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+	})
+	if err != nil {
+		return err
+	}
+	manifest.Status.CredentialsFingerprint = fingerprint
+	return nil
+}
+
+// emptySessionPolicy resets session policy of access key, so it inherits permissions of the user.
+const emptySessionPolicy = "{}"
+
+// sessionPolicyChanged checks that session policy in MinIO differs from desired. Empty policy means inherited one.
+func sessionPolicyChanged(policy string, info madmin.InfoServiceAccountResp) (bool, error) {
+	if policy == "" {
+		return !info.ImpliedPolicy, nil
+	}
+	if info.ImpliedPolicy {
+		return true, nil
+	}
+	diff, err := policyDiff([]byte(policy), []byte(info.Policy), false)
+	return diff != "", err
+}
+
+func (r *AccessKeyReconciler) revoke(ctx context.Context, accessKey string) error {
+	if accessKey == "" {
+		return nil
+	}
+	err := r.Admin.DeleteServiceAccount(ctx, accessKey)
+	if err == nil || isNoSuchServiceAccount(err) {
+		return nil
+	}
+	return err
+}
+
+// createOrUpdateSecret returns credentials from secret or generates new ones. Secrets not controlled by the access key
+// are not updated (errSecretNotOwned).
+func (r *AccessKeyReconciler) createOrUpdateSecret(ctx context.Context, manifest *miniov1alpha1.AccessKey) (accessKey, secretKey string, err error) {
+	var secret = &v1.Secret{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: manifest.SecretName()}, secret)
+	if err == nil {
+		if !metav1.IsControlledBy(secret, manifest) {
+			return "", "", fmt.Errorf("%w: %s", errSecretNotOwned, secret.Name)
+		}
+		accessKey, secretKey := string(secret.Data[secretAccessKeyID]), string(secret.Data[secretSecretAccessKey])
+		if accessKey != "" && (manifest.Status.AccessKey == "" || manifest.Status.AccessKey == accessKey) && len(secretKey) == 2*serviceAccountSecretSize {
+			return accessKey, secretKey, nil
+		}
+		accessKey, secretKey = r.newCredentials(manifest)
+		secret.Data = map[string][]byte{
+			secretAccessKeyID:     []byte(accessKey),
+			secretSecretAccessKey: []byte(secretKey),
+		}
+		return accessKey, secretKey, r.Update(ctx, secret)
+	}
+	if !errors2.IsNotFound(err) {
+		return "", "", err
+	}
+	accessKey, secretKey = r.newCredentials(manifest)
+	secret = &v1.Secret{
+		ObjectMeta: ctrl.ObjectMeta{
+			Name:      manifest.SecretName(),
+			Namespace: manifest.Namespace,
+		},
+		Data: map[string][]byte{
+			secretAccessKeyID:     []byte(accessKey),
+			secretSecretAccessKey: []byte(secretKey),
+		},
+	}
+
+	if err := ctrl.SetControllerReference(manifest, secret, r.Scheme); err != nil {
+		return "", "", fmt.Errorf("set controller refrence: %w", err)
+	}
+	return accessKey, secretKey, r.Create(ctx, secret)
+}
+
+// newCredentials generates new secret key. Access key is generated only once.
+func (r *AccessKeyReconciler) newCredentials(manifest *miniov1alpha1.AccessKey) (accessKey, secretKey string) {
+	accessKey = manifest.Status.AccessKey
+	if accessKey == "" {
+		accessKey = mustGetSecret(serviceAccountKeySize)
+	}
+	return accessKey, mustGetSecret(serviceAccountSecretSize)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AccessKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &miniov1alpha1.AccessKey{}, accessKeyUserRefField, func(object client.Object) []string {
+		return []string{object.(*miniov1alpha1.AccessKey).Spec.UserRef.Name}
+	})
+	if err != nil {
+		return fmt.Errorf("index user ref: %w", err)
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&miniov1alpha1.AccessKey{}).
+		Owns(&v1.Secret{}).
+		Watches(&source.Kind{Type: &miniov1alpha1.User{}}, handler.EnqueueRequestsFromMapFunc(r.accessKeysOfUser))
+	builder = r.Scope.watch(builder, r.Client, func() client.ObjectList {
+		return &miniov1alpha1.AccessKeyList{}
+	})
+	sandboxed := *r
+	sandboxed.Client = sandbox(r.Client)
+	return completeWithBackoff(builder, r.Scope.wrap(r.DryRun.wrap(r.Client, r, &sandboxed, func() client.Object {
+		return &miniov1alpha1.AccessKey{}
+	}, func(obj client.Object) (*[]metav1.Condition, *[]string) {
+		status := &obj.(*miniov1alpha1.AccessKey).Status
+		return &status.Conditions, &status.Plan
+	})))
+}
+
+func (r *AccessKeyReconciler) accessKeysOfUser(object client.Object) []reconcile.Request {
+	var list miniov1alpha1.AccessKeyList
+	err := r.List(context.Background(), &list, client.InNamespace(object.GetNamespace()), client.MatchingFields{accessKeyUserRefField: object.GetName()})
+	if err != nil {
+		log.Log.Error(err, "failed to list access keys", "user", object.GetName())
+		return nil
+	}
+	var requests = make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
+}
+
+func isNoSuchServiceAccount(err error) bool {
+	merr, ok := err.(madmin.ErrorResponse)
+	return ok && merr.Code == "XMinioAdminServiceAccountNotFound"
+}
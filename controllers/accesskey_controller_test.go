@@ -0,0 +1,93 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func TestAccessKeyReconciler_createOrUpdateSecret(t *testing.T) {
+	scheme := testScheme()
+	key := &miniov1alpha1.AccessKey{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: types.UID("key")}}
+	user := &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: types.UID("user")}}
+	credentials := map[string][]byte{
+		secretAccessKeyID:     []byte("existing"),
+		secretSecretAccessKey: []byte(strings.Repeat("x", 2*serviceAccountSecretSize)),
+	}
+	secretOf := func(owner client.Object, name string) *v1.Secret {
+		secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}, Data: credentials}
+		if owner != nil {
+			must(t, ctrl.SetControllerReference(owner, secret, scheme))
+		}
+		return secret
+	}
+
+	cases := []struct {
+		name      string
+		secret    *v1.Secret
+		accessKey string
+		conflict  bool
+	}{
+		{name: "new secret"},
+		{name: "own secret", secret: secretOf(key, key.SecretName()), accessKey: "existing"},
+		{name: "user secret with default name", secret: secretOf(user, user.SecretName())},
+		{name: "user secret with the same name", secret: secretOf(user, key.SecretName()), conflict: true},
+		{name: "unmanaged secret", secret: secretOf(nil, key.SecretName()), conflict: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tc.secret != nil {
+				builder = builder.WithObjects(tc.secret)
+			}
+			r := &AccessKeyReconciler{Client: builder.Build(), Scheme: scheme}
+			accessKey, _, err := r.createOrUpdateSecret(context.Background(), key.DeepCopy())
+			if tc.conflict {
+				if !errors.Is(err, errSecretNotOwned) {
+					t.Fatalf("expected conflict, got %v", err)
+				}
+				var secret v1.Secret
+				must(t, r.Get(context.Background(), client.ObjectKeyFromObject(tc.secret), &secret))
+				if string(secret.Data[secretAccessKeyID]) != "existing" {
+					t.Errorf("foreign secret overwritten")
+				}
+				return
+			}
+			must(t, err)
+			if tc.accessKey != "" && accessKey != tc.accessKey {
+				t.Errorf("expected access key %q, got %q", tc.accessKey, accessKey)
+			}
+			var secret v1.Secret
+			must(t, r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: key.SecretName()}, &secret))
+			if !metav1.IsControlledBy(&secret, key) {
+				t.Errorf("secret is not controlled by access key")
+			}
+		})
+	}
+}
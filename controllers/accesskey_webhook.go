@@ -0,0 +1,51 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/mutate-minio-k8s-reddec-net-v1alpha1-accesskey,mutating=true,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=accesskeys,verbs=create;update,versions=v1alpha1,name=maccesskey.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// AccessKeyDefaulter persists defaults of AccessKey resources on admission, so effective values are visible.
+type AccessKeyDefaulter struct{}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (d *AccessKeyDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.AccessKey{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+func (d *AccessKeyDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	manifest := obj.(*miniov1alpha1.AccessKey)
+	if manifest.Name == "" {
+		// name is not generated yet
+		return nil
+	}
+	if manifest.Spec.SecretName == "" {
+		manifest.Spec.SecretName = manifest.SecretName()
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// AuditPath is path of endpoint for MinIO audit webhook.
+const AuditPath = "/minio/audit"
+
+// audited MinIO APIs which may change managed resources
+var (
+	auditBucketAPIs = []string{"DeleteBucket", "PutBucketPolicy", "DeleteBucketPolicy"}
+	auditUserAPIs   = []string{"AddUser", "RemoveUser", "SetUserStatus"}
+	auditPolicyAPIs = []string{"AddCannedPolicy", "RemoveCannedPolicy"}
+	auditAttachAPIs = []string{"SetPolicy", "SetPolicyForUserOrGroup"}
+)
+
+// auditEntry is part of MinIO audit log entry used for mapping to resources.
+type auditEntry struct {
+	API struct {
+		Name       string `json:"name"`
+		Bucket     string `json:"bucket"`
+		StatusCode int    `json:"statusCode"`
+	} `json:"api"`
+	RequestQuery map[string]string `json:"requestQuery"`
+	AccessKey    string            `json:"accessKey"`
+}
+
+// ErrAuditToken is returned if audit webhook is enabled without token.
+var ErrAuditToken = errors.New("audit webhook requires token")
+
+// AuditReceiver accepts MinIO audit log webhook and enqueues managed resources affected by out-of-band changes.
+// Resources are sent to channels, which are consumed by reconcilers as source.Channel.
+type AuditReceiver struct {
+	client.Reader
+	// Address to listen.
+	Address string
+	// Expected value of Authorization header (auth_token in MinIO). Required: receiver does not start without it.
+	Token string
+	// Changes made by the access key are ignored (operator itself).
+	IgnoreAccessKey string
+
+	Buckets  chan event.GenericEvent
+	Users    chan event.GenericEvent
+	Policies chan event.GenericEvent
+}
+
+// NewAuditReceiver creates receiver with buffered channels.
+func NewAuditReceiver(reader client.Reader, address string) *AuditReceiver {
+	return &AuditReceiver{
+		Reader:   reader,
+		Address:  address,
+		Buckets:  make(chan event.GenericEvent, 128),
+		Users:    make(chan event.GenericEvent, 128),
+		Policies: make(chan event.GenericEvent, 128),
+	}
+}
+
+// Start serves webhook till context is done. Implements manager.Runnable. Runs only on leader, since events are
+// consumed by controllers.
+func (a *AuditReceiver) Start(ctx context.Context) error {
+	if a.Token == "" {
+		return ErrAuditToken
+	}
+	listener, err := net.Listen("tcp", a.Address)
+	if err != nil {
+		return fmt.Errorf("listen audit webhook: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(AuditPath, a)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	ctrl.Log.WithName("audit").Info("serving audit webhook", "address", a.Address, "path", AuditPath)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (a *AuditReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(request) {
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// MinIO sends single entry per request, but batches are accepted as well
+	decoder := json.NewDecoder(request.Body)
+	for {
+		var entry auditEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			http.Error(writer, "invalid audit entry", http.StatusBadRequest)
+			return
+		}
+		if err := a.handle(request.Context(), &entry); err != nil {
+			ctrl.Log.WithName("audit").Error(err, "failed to handle audit entry", "api", entry.API.Name)
+			http.Error(writer, "failed to handle entry", http.StatusInternalServerError)
+			return
+		}
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (a *AuditReceiver) authorized(request *http.Request) bool {
+	if a.Token == "" {
+		return false
+	}
+	header := request.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(strings.TrimPrefix(a.Token, "Bearer "))) == 1
+}
+
+// handle maps audit entry to managed resources and enqueues them.
+func (a *AuditReceiver) handle(ctx context.Context, entry *auditEntry) error {
+	if entry.API.StatusCode >= http.StatusMultipleChoices || (a.IgnoreAccessKey != "" && entry.AccessKey == a.IgnoreAccessKey) {
+		return nil
+	}
+	query := entry.RequestQuery
+	switch {
+	case contains(auditBucketAPIs, entry.API.Name) && entry.API.Bucket != "":
+		return a.enqueueBuckets(ctx, entry.API.Bucket)
+	case contains(auditUserAPIs, entry.API.Name) && query["accessKey"] != "":
+		return a.enqueueUsers(ctx, query["accessKey"])
+	case contains(auditPolicyAPIs, entry.API.Name) && query["name"] != "":
+		return a.enqueuePolicies(ctx, func(item *miniov1alpha1.Policy) bool {
+			return item.Status.Name == query["name"]
+		})
+	case contains(auditAttachAPIs, entry.API.Name) && query["userOrGroup"] != "" && query["isGroup"] != "true":
+		return a.enqueueUsers(ctx, query["userOrGroup"])
+	}
+	return nil
+}
+
+func (a *AuditReceiver) enqueueBuckets(ctx context.Context, bucket string) error {
+	var list miniov1alpha1.BucketList
+	if err := a.List(ctx, &list); err != nil {
+		return fmt.Errorf("list buckets: %w", err)
+	}
+	for i := range list.Items {
+		if list.Items[i].BucketName() == bucket {
+			if err := send(ctx, a.Buckets, &list.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueueUsers enqueues users with the access key and policies attached to them.
+func (a *AuditReceiver) enqueueUsers(ctx context.Context, accessKey string) error {
+	var list miniov1alpha1.UserList
+	if err := a.List(ctx, &list); err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+	var users = make(map[client.ObjectKey]bool)
+	for i := range list.Items {
+		if list.Items[i].AccessKey() == accessKey {
+			users[client.ObjectKeyFromObject(&list.Items[i])] = true
+			if err := send(ctx, a.Users, &list.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return a.enqueuePolicies(ctx, func(item *miniov1alpha1.Policy) bool {
+		if ref := item.Spec.UserRef; ref != nil {
+			return users[client.ObjectKey{Namespace: item.Namespace, Name: ref.Name}]
+		}
+		return item.Spec.GroupRef == nil && item.Spec.User == accessKey
+	})
+}
+
+func (a *AuditReceiver) enqueuePolicies(ctx context.Context, match func(item *miniov1alpha1.Policy) bool) error {
+	var list miniov1alpha1.PolicyList
+	if err := a.List(ctx, &list); err != nil {
+		return fmt.Errorf("list policies: %w", err)
+	}
+	for i := range list.Items {
+		if match(&list.Items[i]) {
+			if err := send(ctx, a.Policies, &list.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func send(ctx context.Context, ch chan<- event.GenericEvent, obj client.Object) error {
+	select {
+	case ch <- event.GenericEvent{Object: obj}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
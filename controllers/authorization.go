@@ -0,0 +1,232 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// ErrNotAuthorized is returned (wrapped) if namespace rules do not allow action.
+var ErrNotAuthorized = errors.New("not authorized")
+
+// Authorizer enforces namespace rules from OperatorConfig. Nil authorizer allows everything.
+type Authorizer struct {
+	// Reader for cluster-scoped resources. Uncached reader is preferred since cache may be limited by namespaces.
+	Reader client.Reader
+	// Name of OperatorConfig resource.
+	ConfigName string
+	// Name of MinIO connection used by operator.
+	Connection string
+}
+
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=operatorconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// CheckConnection checks that namespace may use MinIO connection of operator.
+func (a *Authorizer) CheckConnection(ctx context.Context, namespace string) error {
+	if a == nil {
+		return nil
+	}
+	rules, err := a.rules(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	return a.checkConnection(namespace, rules)
+}
+
+// CheckBucket checks that namespace may use bucket by name prefixes. If create is true, namespace should be allowed
+// to create buckets.
+func (a *Authorizer) CheckBucket(ctx context.Context, namespace string, bucket string, create bool) error {
+	if a == nil {
+		return nil
+	}
+	rules, err := a.rules(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if err := a.checkConnection(namespace, rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if create && !rule.Buckets {
+			continue
+		}
+		if len(rule.BucketPrefixes) == 0 || hasPrefix(bucket, rule.BucketPrefixes) {
+			return nil
+		}
+	}
+	if create {
+		return fmt.Errorf("%w: namespace %s can not create bucket %s", ErrNotAuthorized, namespace, bucket)
+	}
+	return fmt.Errorf("%w: namespace %s can not use bucket %s", ErrNotAuthorized, namespace, bucket)
+}
+
+// CheckGroupPolicies checks that namespace may attach canned policies to groups by name.
+func (a *Authorizer) CheckGroupPolicies(ctx context.Context, namespace string, policies []string) error {
+	if a == nil {
+		return nil
+	}
+	rules, err := a.rules(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if err := a.checkConnection(namespace, rules); err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if !policyAllowed(policy, rules) {
+			return fmt.Errorf("%w: namespace %s can not attach policy %s", ErrNotAuthorized, namespace, policy)
+		}
+	}
+	return nil
+}
+
+// CheckAdopt checks that namespace may take over existing canned policy or group in MinIO by name. Empty name
+// checks only connection.
+func (a *Authorizer) CheckAdopt(ctx context.Context, namespace string, name string) error {
+	if a == nil {
+		return nil
+	}
+	rules, err := a.rules(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if err := a.checkConnection(namespace, rules); err != nil {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+	for _, rule := range rules {
+		if hasPrefix(name, rule.AdoptPrefixes) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: namespace %s can not adopt %s", ErrNotAuthorized, namespace, name)
+}
+
+func policyAllowed(policy string, rules []miniov1alpha1.NamespaceRule) bool {
+	for _, rule := range rules {
+		if contains(rule.Policies, policy) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authorizer) checkConnection(namespace string, rules []miniov1alpha1.NamespaceRule) error {
+	for _, rule := range rules {
+		if len(rule.Connections) == 0 || contains(rule.Connections, a.Connection) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: namespace %s can not use connection %s", ErrNotAuthorized, namespace, a.Connection)
+}
+
+// rules returns rules matched to namespace.
+func (a *Authorizer) rules(ctx context.Context, namespace string) ([]miniov1alpha1.NamespaceRule, error) {
+	var config miniov1alpha1.OperatorConfig
+	err := a.Reader.Get(ctx, client.ObjectKey{Name: a.ConfigName}, &config)
+	if errors2.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: operator config %s not found", ErrNotAuthorized, a.ConfigName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get operator config: %w", err)
+	}
+
+	var ns *v1.Namespace
+	var matched []miniov1alpha1.NamespaceRule
+	for _, rule := range config.Spec.Rules {
+		if contains(rule.Namespaces, namespace) || contains(rule.Namespaces, miniov1alpha1.AnyNamespace) {
+			matched = append(matched, rule)
+			continue
+		}
+		if rule.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(rule.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("parse namespace selector: %w", err)
+		}
+		if ns == nil {
+			ns = &v1.Namespace{}
+			if err := a.Reader.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+				return nil, fmt.Errorf("get namespace: %w", err)
+			}
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched, nil
+}
+
+// authorize reflects result of check in authorized condition. Returns false if action is not allowed.
+// Errors other than ErrNotAuthorized are returned.
+func (a *Authorizer) authorize(conditions *[]metav1.Condition, check error) (bool, error) {
+	if a == nil {
+		return true, nil
+	}
+	if errors.Is(check, ErrNotAuthorized) {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    miniov1alpha1.ConditionAuthorized,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Denied",
+			Message: check.Error(),
+		})
+		return false, nil
+	}
+	if check != nil {
+		return false, fmt.Errorf("check authorization: %w", check)
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:   miniov1alpha1.ConditionAuthorized,
+		Status: metav1.ConditionTrue,
+		Reason: "Authorized",
+	})
+	return true, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
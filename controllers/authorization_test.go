@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizer_CheckAdopt(t *testing.T) {
+	cases := []struct {
+		namespace string
+		name      string
+		allowed   bool
+	}{
+		{namespace: "team-a", name: "", allowed: true},
+		{namespace: "team-a", name: "team-a-legacy", allowed: true},
+		{namespace: "team-a", name: "team-b-writers"},
+		{namespace: "team-b", name: "", allowed: true},
+		{namespace: "team-b", name: "team-b-writers"},
+		{namespace: "team-c", name: "team-c-writers"},
+	}
+	authorizer := testAuthorizer()
+	for _, tc := range cases {
+		t.Run(tc.namespace+"/"+tc.name, func(t *testing.T) {
+			err := authorizer.CheckAdopt(context.Background(), tc.namespace, tc.name)
+			if tc.allowed && err != nil {
+				t.Errorf("expected allowed, got %v", err)
+			}
+			if !tc.allowed && !errors.Is(err, ErrNotAuthorized) {
+				t.Errorf("expected not authorized, got %v", err)
+			}
+		})
+	}
+}
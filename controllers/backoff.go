@@ -0,0 +1,180 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// errorClass groups MinIO errors by retry strategy.
+type errorClass string
+
+const (
+	errorClassOther      errorClass = ""
+	errorClassAuth       errorClass = "auth"
+	errorClassThrottling errorClass = "throttling"
+	errorClassNetwork    errorClass = "network"
+	errorClassNotFound   errorClass = "not-found"
+)
+
+// retry delays by error class: delay starts from base and doubles on each failure till max.
+var classBackoff = map[errorClass]struct{ base, max time.Duration }{
+	errorClassAuth:       {base: 30 * time.Second, max: 10 * time.Minute},
+	errorClassThrottling: {base: 5 * time.Second, max: 5 * time.Minute},
+	errorClassNetwork:    {base: 5 * time.Second, max: 5 * time.Minute},
+	errorClassNotFound:   {base: 10 * time.Second, max: 2 * time.Minute},
+}
+
+// Retries after MinIO errors are limited overall, so recovery after outage is spread in time.
+const (
+	minioRetryRate  = 5
+	minioRetryBurst = 10
+)
+
+var (
+	authErrorCodes = []string{"AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken",
+		"InvalidToken", "XMinioAdminInvalidAccessKey", "XMinioAdminInvalidSecretKey"}
+	throttlingErrorCodes = []string{"SlowDown", "SlowDownRead", "SlowDownWrite", "ServiceUnavailable",
+		"XMinioServerNotInitialized", "RequestTimeout"}
+)
+
+// classifyError returns class of MinIO error.
+func classifyError(err error) errorClass {
+	var code string
+	var status int
+	var adminErr madmin.ErrorResponse
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &adminErr) {
+		code = adminErr.Code
+	} else if errors.As(err, &s3Err) {
+		code, status = s3Err.Code, s3Err.StatusCode
+	}
+	switch {
+	case contains(authErrorCodes, code) || status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return errorClassAuth
+	case contains(throttlingErrorCodes, code) || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return errorClassThrottling
+	case strings.Contains(code, "NoSuch") || status == http.StatusNotFound:
+		return errorClassNotFound
+	case code != "":
+		return errorClassOther
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorClassNetwork
+	}
+	return errorClassOther
+}
+
+// ErrorRateLimiter delays retries of failed reconciles by class of MinIO error with jittered exponential backoff.
+// Other errors are handled by default controller rate limiter. Class of the last error is recorded by Wrap.
+type ErrorRateLimiter struct {
+	fallback workqueue.RateLimiter
+	shared   *rate.Limiter
+
+	lock     sync.Mutex
+	classes  map[interface{}]errorClass
+	failures map[interface{}]int
+}
+
+// NewErrorRateLimiter creates rate limiter for single controller.
+func NewErrorRateLimiter() *ErrorRateLimiter {
+	return &ErrorRateLimiter{
+		fallback: workqueue.DefaultControllerRateLimiter(),
+		shared:   rate.NewLimiter(minioRetryRate, minioRetryBurst),
+		classes:  make(map[interface{}]errorClass),
+		failures: make(map[interface{}]int),
+	}
+}
+
+func (l *ErrorRateLimiter) When(item interface{}) time.Duration {
+	l.lock.Lock()
+	backoff, ok := classBackoff[l.classes[item]]
+	if !ok {
+		l.lock.Unlock()
+		return l.fallback.When(item)
+	}
+	failures := l.failures[item]
+	l.failures[item] = failures + 1
+	l.lock.Unlock()
+
+	delay := backoff.base
+	for i := 0; i < failures && delay < backoff.max; i++ {
+		delay *= 2
+	}
+	if delay > backoff.max {
+		delay = backoff.max
+	}
+	// +-20% to not retry all resources at once
+	delay = time.Duration(float64(delay) * (0.8 + 0.4*rand.Float64()))
+	if shared := l.shared.Reserve().Delay(); shared > delay {
+		delay = shared
+	}
+	return delay
+}
+
+func (l *ErrorRateLimiter) Forget(item interface{}) {
+	l.lock.Lock()
+	delete(l.classes, item)
+	delete(l.failures, item)
+	l.lock.Unlock()
+	l.fallback.Forget(item)
+}
+
+func (l *ErrorRateLimiter) NumRequeues(item interface{}) int {
+	l.lock.Lock()
+	failures := l.failures[item]
+	l.lock.Unlock()
+	return failures + l.fallback.NumRequeues(item)
+}
+
+// Wrap records class of reconcile errors for the rate limiter.
+func (l *ErrorRateLimiter) Wrap(r reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		result, err := r.Reconcile(ctx, req)
+		l.lock.Lock()
+		if err != nil {
+			l.classes[req] = classifyError(err)
+		} else {
+			delete(l.classes, req)
+		}
+		l.lock.Unlock()
+		return result, err
+	})
+}
+
+// completeWithBackoff builds controller with rate limiter aware of MinIO errors.
+func completeWithBackoff(b *builder.Builder, r reconcile.Reconciler) error {
+	limiter := NewErrorRateLimiter()
+	return b.WithOptions(controller.Options{RateLimiter: limiter}).Complete(limiter.Wrap(r))
+}
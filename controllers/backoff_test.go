@@ -0,0 +1,115 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected errorClass
+	}{
+		{name: "admin auth", err: madmin.ErrorResponse{Code: "XMinioAdminInvalidAccessKey"}, expected: errorClassAuth},
+		{name: "s3 auth code", err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, expected: errorClassAuth},
+		{name: "s3 forbidden", err: minio.ErrorResponse{StatusCode: http.StatusForbidden}, expected: errorClassAuth},
+		{name: "throttling code", err: minio.ErrorResponse{Code: "SlowDown"}, expected: errorClassThrottling},
+		{name: "too many requests", err: minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, expected: errorClassThrottling},
+		{name: "not initialized", err: madmin.ErrorResponse{Code: "XMinioServerNotInitialized"}, expected: errorClassThrottling},
+		{name: "no such bucket", err: minio.ErrorResponse{Code: "NoSuchBucket", StatusCode: http.StatusNotFound}, expected: errorClassNotFound},
+		{name: "no such user", err: madmin.ErrorResponse{Code: "XMinioAdminNoSuchUser"}, expected: errorClassNotFound},
+		{name: "other code", err: madmin.ErrorResponse{Code: "XMinioAdminInvalidArgument"}, expected: errorClassOther},
+		{name: "wrapped", err: fmt.Errorf("create bucket: %w", minio.ErrorResponse{Code: "SlowDown"}), expected: errorClassThrottling},
+		{name: "network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: errorClassNetwork},
+		{name: "timeout", err: fmt.Errorf("list users: %w", context.DeadlineExceeded), expected: errorClassNetwork},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, expected: errorClassNetwork},
+		{name: "kubernetes", err: errors.New("update status: conflict"), expected: errorClassOther},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if class := classifyError(tc.err); class != tc.expected {
+				t.Errorf("expected class %q, got %q", tc.expected, class)
+			}
+		})
+	}
+}
+
+func TestErrorRateLimiter_When(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		failures int           // previous failures
+		min, max time.Duration // expected delay of the next retry
+	}{
+		{name: "other error uses default limiter", err: errors.New("conflict"), min: 5 * time.Millisecond, max: 5 * time.Millisecond},
+		{name: "first auth error", err: madmin.ErrorResponse{Code: "AccessDenied"}, min: 24 * time.Second, max: 36 * time.Second},
+		{name: "second auth error", err: madmin.ErrorResponse{Code: "AccessDenied"}, failures: 1, min: 48 * time.Second, max: 72 * time.Second},
+		{name: "network error is limited", err: io.ErrUnexpectedEOF, failures: 20, min: 4 * time.Minute, max: 6 * time.Minute},
+		{name: "not found", err: minio.ErrorResponse{Code: "NoSuchBucket"}, failures: 2, min: 32 * time.Second, max: 48 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := NewErrorRateLimiter()
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "item"}}
+			reconciler := limiter.Wrap(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+				return reconcile.Result{}, tc.err
+			}))
+			if _, err := reconciler.Reconcile(context.Background(), req); err == nil {
+				t.Fatal("expected reconcile error")
+			}
+			for i := 0; i < tc.failures; i++ {
+				limiter.When(req)
+			}
+			delay := limiter.When(req)
+			if delay < tc.min || delay > tc.max {
+				t.Errorf("expected delay in [%v, %v], got %v", tc.min, tc.max, delay)
+			}
+		})
+	}
+}
+
+func TestErrorRateLimiter_Forget(t *testing.T) {
+	limiter := NewErrorRateLimiter()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "item"}}
+	reconciler := limiter.Wrap(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+		return reconcile.Result{}, madmin.ErrorResponse{Code: "AccessDenied"}
+	}))
+	_, _ = reconciler.Reconcile(context.Background(), req)
+	limiter.When(req)
+	limiter.When(req)
+	if n := limiter.NumRequeues(req); n != 2 {
+		t.Errorf("expected 2 requeues, got %d", n)
+	}
+	limiter.Forget(req)
+	if n := limiter.NumRequeues(req); n != 0 {
+		t.Errorf("expected no requeues after forget, got %d", n)
+	}
+}
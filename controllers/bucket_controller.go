@@ -19,21 +19,25 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/policy"
 	"github.com/minio/minio-go/v7/pkg/set"
 	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const bucketFinalizer = "reddec.net.k8s.minio-bucket-finalizer"
@@ -42,12 +46,27 @@ const bucketFinalizer = "reddec.net.k8s.minio-bucket-finalizer"
 type BucketReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
-	Minio  *minio.Client
+	Minio  S3API
+	// Recorder for events about MinIO changes.
+	Recorder record.EventRecorder
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Timings of periodic reconciliation.
+	Resync Resync
+	// Global pause. Annotation pause works without it.
+	Pause *Pause
+	// Global dry-run. Annotation dry-run works without it.
+	DryRun *DryRun
+	// Namespaces to reconcile. Nil scope allows all namespaces.
+	Scope *Scope
+	// Events from MinIO audit webhook. Optional.
+	Events <-chan event.GenericEvent
 }
 
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=buckets,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=buckets/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=buckets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=buckets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=buckets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=buckets/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -64,11 +83,35 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, fmt.Errorf("get manifest: %w", err)
 	}
 
+	allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, r.Authorizer.CheckBucket(ctx, manifest.Namespace, manifest.BucketName(), true))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// pause stops all changes in MinIO, including removal
+	paused, err := r.Pause.hold(ctx, manifest, &manifest.Status.Conditions)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
 	// removal
 	if manifest.GetDeletionTimestamp() != nil {
 		logger.Info("removing bucket (if needed)")
-		if err := r.removeBucket(ctx, manifest); err != nil {
-			return ctrl.Result{}, fmt.Errorf("remove bucket: %w", err)
+		if !allowed {
+			logger.Info("not authorized, MinIO state is kept")
+		} else if err := r.removeBucket(ctx, manifest); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "DeletionBlocked", fmt.Errorf("remove bucket: %w", err))
+		} else if manifest.Spec.Retain {
+			r.Recorder.Event(manifest, v1.EventTypeNormal, "BucketRetained", "bucket "+manifest.BucketName()+" kept in MinIO")
+		} else {
+			r.Recorder.Event(manifest, v1.EventTypeNormal, "BucketRemoved", "bucket "+manifest.BucketName()+" removed from MinIO")
 		}
 		controllerutil.RemoveFinalizer(manifest, bucketFinalizer)
 		if err := r.Update(ctx, manifest); err != nil {
@@ -77,6 +120,14 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, nil
 	}
 
+	if !allowed {
+		logger.Info("not authorized by namespace rules")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
 	// add finalizer
 	if !controllerutil.ContainsFinalizer(manifest, bucketFinalizer) {
 		controllerutil.AddFinalizer(manifest, bucketFinalizer)
@@ -86,56 +137,101 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// always create bucket
-	if exist, err := r.Minio.BucketExists(ctx, manifest.Name); err != nil {
-		logger.Info("bucket already exists")
-		return ctrl.Result{}, fmt.Errorf("check bucket: %w", err)
+	var drift []string
+	if exist, err := r.Minio.BucketExists(ctx, manifest.BucketName()); err != nil {
+		return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("check bucket: %w", err))
 	} else if !exist {
+		if manifest.IsReady() {
+			drift = append(drift, "bucket is missing")
+		}
 		logger.Info("creating new bucket")
-		if err := r.Minio.MakeBucket(ctx, manifest.Name, minio.MakeBucketOptions{}); err != nil {
-			return ctrl.Result{}, fmt.Errorf("create bucket: %w", err)
+		if err := r.Minio.MakeBucket(ctx, manifest.BucketName(), minio.MakeBucketOptions{}); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("create bucket: %w", err))
 		}
+		r.Recorder.Event(manifest, v1.EventTypeNormal, "BucketCreated", "bucket "+manifest.BucketName()+" created in MinIO")
 	}
 	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
 		Type:   miniov1alpha1.BucketConditionCreated,
-		Status: "true",
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
 	})
-	if err := r.Update(ctx, manifest); err != nil {
+	if err := r.Status().Update(ctx, manifest); err != nil {
 		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
 	}
 
-	// always set policy
-	logger.Info("updating bucket policy")
-
-	if err := r.setBucketPolicy(ctx, manifest); err != nil {
-		return ctrl.Result{}, fmt.Errorf("set bucket policy: %w", err)
+	// set policy if differs
+	diff, err := r.syncBucketPolicy(ctx, manifest)
+	if err != nil {
+		return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("set bucket policy: %w", err))
+	}
+	if diff != "" && appliedCurrent(manifest.Status.Conditions, miniov1alpha1.BucketConditionPolicyAssigned, manifest.Generation) {
+		drift = append(drift, diff)
+	}
+	if !meta.IsStatusConditionTrue(manifest.Status.Conditions, miniov1alpha1.BucketConditionPolicyAssigned) {
+		r.Recorder.Event(manifest, v1.EventTypeNormal, "BucketPolicyApplied", "bucket policy applied")
 	}
 	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
-		Type:   miniov1alpha1.BucketConditionPolicyAssigned,
-		Status: "true",
+		Type:               miniov1alpha1.BucketConditionPolicyAssigned,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Assigned",
+		ObservedGeneration: manifest.Generation,
 	})
-	if err := r.Update(ctx, manifest); err != nil {
+	reportDrift(r.Recorder, manifest, &manifest.Status.Conditions, drift)
+	if err := r.Status().Update(ctx, manifest); err != nil {
 		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
 	}
 
-	return ctrl.Result{Requeue: true, RequeueAfter: time.Minute}, nil
+	return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
 }
 
-func (r *BucketReconciler) setBucketPolicy(ctx context.Context, manifest *miniov1alpha1.Bucket) error {
-	return r.Minio.SetBucketPolicy(ctx, manifest.Name, mustPolicy(manifest))
+// syncBucketPolicy sets bucket policy only if it differs from MinIO. Returns summary of differences.
+func (r *BucketReconciler) syncBucketPolicy(ctx context.Context, manifest *miniov1alpha1.Bucket) (string, error) {
+	desired := mustPolicy(manifest)
+	current, err := r.Minio.GetBucketPolicy(ctx, manifest.BucketName())
+	if err != nil {
+		return "", fmt.Errorf("get bucket policy: %w", err)
+	}
+	diff, err := policyDiff([]byte(desired), []byte(current), true)
+	if err != nil || diff == "" {
+		return "", err
+	}
+	log.FromContext(ctx).Info("updating bucket policy", "diff", diff)
+	if !manifest.Spec.Public {
+		// empty policy removes bucket policy
+		desired = ""
+	}
+	if err := r.Minio.SetBucketPolicy(ctx, manifest.BucketName(), desired); err != nil {
+		return "", err
+	}
+	return diff, nil
 }
 
 func (r *BucketReconciler) removeBucket(ctx context.Context, manifest *miniov1alpha1.Bucket) error {
 	if manifest.Spec.Retain {
 		return nil
 	}
-	return r.Minio.RemoveBucketWithOptions(ctx, manifest.Name, minio.RemoveBucketOptions{ForceDelete: true})
+	return r.Minio.RemoveBucketWithOptions(ctx, manifest.BucketName(), minio.RemoveBucketOptions{ForceDelete: true})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&miniov1alpha1.Bucket{}).
-		Complete(r)
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&miniov1alpha1.Bucket{})
+	if r.Events != nil {
+		builder = builder.Watches(&source.Channel{Source: r.Events}, &handler.EnqueueRequestForObject{})
+	}
+	builder = r.Scope.watch(builder, r.Client, func() client.ObjectList {
+		return &miniov1alpha1.BucketList{}
+	})
+	sandboxed := *r
+	sandboxed.Client = sandbox(r.Client)
+	sandboxed.Recorder = discardRecorder{}
+	return completeWithBackoff(builder, r.Scope.wrap(r.DryRun.wrap(r.Client, r, &sandboxed, func() client.Object {
+		return &miniov1alpha1.Bucket{}
+	}, func(obj client.Object) (*[]metav1.Condition, *[]string) {
+		status := &obj.(*miniov1alpha1.Bucket).Status
+		return &status.Conditions, &status.Plan
+	})))
 }
 
 func mustPolicy(manifest *miniov1alpha1.Bucket) string {
@@ -151,7 +247,7 @@ func mustPolicy(manifest *miniov1alpha1.Bucket) string {
 			Principal: policy.User{
 				AWS: set.CreateStringSet("*"),
 			},
-			Resources: set.CreateStringSet("arn:aws:s3:::" + manifest.Name + "/*"),
+			Resources: set.CreateStringSet("arn:aws:s3:::" + manifest.BucketName() + "/*"),
 		})
 	}
 	data, err := json.Marshal(p)
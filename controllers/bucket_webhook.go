@@ -0,0 +1,69 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/validate-minio-k8s-reddec-net-v1alpha1-bucket,mutating=false,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=buckets,verbs=create;update,versions=v1alpha1,name=vbucket.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// BucketValidator validates Bucket resources on admission.
+type BucketValidator struct {
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (v *BucketValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.Bucket{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *BucketValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(ctx, obj.(*miniov1alpha1.Bucket))
+}
+
+// ValidateUpdate checks the same rules as on creation: bucket name (metadata.name) is immutable by Kubernetes,
+// spec fields can be changed, but namespace rules may have changed since creation.
+func (v *BucketValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return v.validate(ctx, newObj.(*miniov1alpha1.Bucket))
+}
+
+func (v *BucketValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *BucketValidator) validate(ctx context.Context, manifest *miniov1alpha1.Bucket) error {
+	errs := validateBucketName(field.NewPath("metadata", "name"), manifest.BucketName())
+	denied, err := authorizationError(v.Authorizer.CheckBucket(ctx, manifest.Namespace, manifest.BucketName(), true))
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		errs = append(errs, denied)
+	}
+	return invalid("Bucket", manifest.Name, errs)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// reportDrift reflects out-of-band changes reverted by reconcile in condition and emits event. Empty drift means that
+// MinIO state matched the resource.
+func reportDrift(recorder record.EventRecorder, obj client.Object, conditions *[]metav1.Condition, drift []string) {
+	if len(drift) == 0 {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:   miniov1alpha1.ConditionDriftDetected,
+			Status: metav1.ConditionFalse,
+			Reason: "InSync",
+		})
+		return
+	}
+	summary := strings.Join(drift, "; ")
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    miniov1alpha1.ConditionDriftDetected,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Reverted",
+		Message: summary,
+	})
+	recorder.Event(obj, v1.EventTypeWarning, "DriftDetected", "out-of-band changes reverted: "+summary)
+}
+
+// appliedCurrent checks that condition is true and was set for the current generation of the resource. Difference
+// between MinIO and such resource is caused by out-of-band changes, not by changes of spec.
+func appliedCurrent(conditions []metav1.Condition, conditionType string, generation int64) bool {
+	condition := meta.FindStatusCondition(conditions, conditionType)
+	return condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == generation
+}
+
+// credentialsFingerprint identifies credentials set in MinIO without revealing them. Resource UID is used as salt.
+func credentialsFingerprint(obj client.Object, accessKey, secretKey string) string {
+	sum := sha256.Sum256([]byte(string(obj.GetUID()) + ":" + accessKey + ":" + secretKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// policyDiff returns short summary of differences between expected and actual policy documents. Empty summary means
+// that policies are equal. Statement IDs and versions are ignored, principals are compared only if withPrincipal
+// is true (MinIO does not keep principals in canned policies).
+func policyDiff(expected, actual []byte, withPrincipal bool) (string, error) {
+	expectedStatements, err := policyStatements(expected, withPrincipal)
+	if err != nil {
+		return "", fmt.Errorf("parse expected policy: %w", err)
+	}
+	actualStatements, err := policyStatements(actual, withPrincipal)
+	if err != nil {
+		return "policy can not be parsed", nil
+	}
+	if len(actual) == 0 && len(expectedStatements) > 0 {
+		return "policy is missing", nil
+	}
+	if equalStatements(expectedStatements, actualStatements) {
+		return "", nil
+	}
+
+	expectedActions, expectedResources := policyItems(expectedStatements)
+	actualActions, actualResources := policyItems(actualStatements)
+	var parts []string
+	for _, item := range []struct {
+		name  string
+		items []string
+	}{
+		{"missing actions", subtract(expectedActions, actualActions)},
+		{"unexpected actions", subtract(actualActions, expectedActions)},
+		{"missing resources", subtract(expectedResources, actualResources)},
+		{"unexpected resources", subtract(actualResources, expectedResources)},
+	} {
+		if len(item.items) > 0 {
+			parts = append(parts, item.name+" "+strings.Join(item.items, ","))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("statements differ (%d expected, %d found)", len(expectedStatements), len(actualStatements)))
+	}
+	return "policy: " + strings.Join(parts, ", "), nil
+}
+
+// normalizedStatement is comparable form of policy statement.
+type normalizedStatement struct {
+	effect     string
+	actions    []string
+	resources  []string
+	principals []string
+	conditions string
+}
+
+func (s normalizedStatement) key() string {
+	return strings.Join([]string{s.effect, strings.Join(s.actions, ","), strings.Join(s.resources, ","),
+		strings.Join(s.principals, ","), s.conditions}, "|")
+}
+
+func policyStatements(doc []byte, withPrincipal bool) ([]normalizedStatement, error) {
+	if len(doc) == 0 {
+		return nil, nil
+	}
+	var parsed policy.BucketAccessPolicy
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		return nil, err
+	}
+	var out = make([]normalizedStatement, 0, len(parsed.Statements))
+	for _, statement := range parsed.Statements {
+		item := normalizedStatement{
+			effect:    statement.Effect,
+			actions:   statement.Actions.ToSlice(),
+			resources: statement.Resources.ToSlice(),
+		}
+		if withPrincipal {
+			item.principals = append(statement.Principal.AWS.ToSlice(), statement.Principal.CanonicalUser.ToSlice()...)
+		}
+		if len(statement.Conditions) > 0 {
+			conditions, err := json.Marshal(statement.Conditions)
+			if err != nil {
+				return nil, err
+			}
+			item.conditions = string(conditions)
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func equalStatements(a, b []normalizedStatement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	var keys = make(map[string]int, len(a))
+	for _, statement := range a {
+		keys[statement.key()]++
+	}
+	for _, statement := range b {
+		keys[statement.key()]--
+	}
+	for _, count := range keys {
+		if count != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// policyItems returns sorted unique actions (prefixed by effect if it is not Allow) and resources of statements.
+func policyItems(statements []normalizedStatement) (actions, resources []string) {
+	var actionSet, resourceSet = make(map[string]bool), make(map[string]bool)
+	for _, statement := range statements {
+		for _, action := range statement.actions {
+			if statement.effect != "Allow" {
+				action = strings.ToLower(statement.effect) + " " + action
+			}
+			actionSet[action] = true
+		}
+		for _, resource := range statement.resources {
+			resourceSet[resource] = true
+		}
+	}
+	return sortedKeys(actionSet), sortedKeys(resourceSet)
+}
+
+// subtract returns items of a which are not in b.
+func subtract(a, b []string) []string {
+	var out []string
+	for _, item := range a {
+		if !contains(b, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var out = make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func TestPolicyDiff(t *testing.T) {
+	const expected = `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"AWS":["app"]},"Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::data/*"]}]}`
+	cases := []struct {
+		name          string
+		actual        string
+		withPrincipal bool
+		diff          string
+	}{
+		{
+			name: "equal with other order and sid",
+			actual: `{"Version":"2012-10-17","Statement":[
+				{"Sid":"1","Effect":"Allow","Principal":{"AWS":["app"]},"Action":["s3:PutObject","s3:GetObject"],"Resource":["arn:aws:s3:::data/*"]}]}`,
+			withPrincipal: true,
+		},
+		{
+			name: "principal ignored",
+			actual: `{"Version":"2012-10-17","Statement":[
+				{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::data/*"]}]}`,
+		},
+		{
+			name: "principal compared",
+			actual: `{"Version":"2012-10-17","Statement":[
+				{"Effect":"Allow","Principal":{"AWS":["other"]},"Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::data/*"]}]}`,
+			withPrincipal: true,
+			diff:          "policy: statements differ (1 expected, 1 found)",
+		},
+		{
+			name: "missing action and unexpected resource",
+			actual: `{"Version":"2012-10-17","Statement":[
+				{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::other/*"]}]}`,
+			diff: "policy: missing actions s3:PutObject, missing resources arn:aws:s3:::data/*, unexpected resources arn:aws:s3:::other/*",
+		},
+		{
+			name: "denied action",
+			actual: `{"Version":"2012-10-17","Statement":[
+				{"Effect":"Deny","Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::data/*"]}]}`,
+			diff: "policy: missing actions s3:GetObject,s3:PutObject, unexpected actions deny s3:GetObject,deny s3:PutObject",
+		},
+		{name: "missing", diff: "policy is missing"},
+		{name: "invalid", actual: "{", diff: "policy can not be parsed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := policyDiff([]byte(expected), []byte(tc.actual), tc.withPrincipal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff != tc.diff {
+				t.Errorf("expected diff %q, got %q", tc.diff, diff)
+			}
+		})
+	}
+}
+
+func TestPolicyDiff_InvalidExpected(t *testing.T) {
+	if _, err := policyDiff([]byte("{"), []byte("{}"), false); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCredentialsFingerprint(t *testing.T) {
+	user := func(uid types.UID) *miniov1alpha1.User {
+		return &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{UID: uid}}
+	}
+	base := credentialsFingerprint(user("uid-1"), "app", "secret")
+	if len(base) != 16 {
+		t.Fatalf("expected 16 hex characters, got %q", base)
+	}
+	cases := []struct {
+		name      string
+		uid       types.UID
+		accessKey string
+		secretKey string
+		same      bool
+	}{
+		{name: "same credentials", uid: "uid-1", accessKey: "app", secretKey: "secret", same: true},
+		{name: "other secret key", uid: "uid-1", accessKey: "app", secretKey: "secret2"},
+		{name: "other access key", uid: "uid-1", accessKey: "app2", secretKey: "secret"},
+		{name: "other resource", uid: "uid-2", accessKey: "app", secretKey: "secret"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fingerprint := credentialsFingerprint(user(tc.uid), tc.accessKey, tc.secretKey)
+			if (fingerprint == base) != tc.same {
+				t.Errorf("expected same %v: %q vs %q", tc.same, fingerprint, base)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// DryRun makes reconcilers only plan changes in MinIO for resources with DryRunAnnotation or for all resources.
+// Planned changes are saved to status and reported by event. Nil dry-run handles only annotation.
+type DryRun struct {
+	// Plan changes for all resources.
+	All bool
+	// Recorder for events with planned changes. Optional.
+	Recorder record.EventRecorder
+}
+
+// statusFunc returns conditions and plan of the resource.
+type statusFunc func(obj client.Object) (conditions *[]metav1.Condition, plan *[]string)
+
+func (d *DryRun) enabled(obj client.Object) bool {
+	if enabled, set := annotationSwitch(obj, miniov1alpha1.DryRunAnnotation); set {
+		return enabled
+	}
+	return d != nil && d.All
+}
+
+// wrap routes requests to live reconciler or, in dry-run mode, to the sandboxed one with the plan in context.
+// Reconciler should use MinIO clients which respect plan (see PlannedAdmin and PlannedS3).
+func (d *DryRun) wrap(c client.Client, live, sandboxed reconcile.Reconciler, newObject func() client.Object, status statusFunc) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		obj := newObject()
+		if err := c.Get(ctx, req.NamespacedName, obj); err != nil {
+			if errors2.IsNotFound(err) {
+				return reconcile.Result{}, nil
+			}
+			return reconcile.Result{}, fmt.Errorf("get manifest: %w", err)
+		}
+
+		if !d.enabled(obj) {
+			conditions, plan := status(obj)
+			if meta.IsStatusConditionTrue(*conditions, miniov1alpha1.ConditionDryRun) {
+				meta.SetStatusCondition(conditions, metav1.Condition{
+					Type:   miniov1alpha1.ConditionDryRun,
+					Status: metav1.ConditionFalse,
+					Reason: "Disabled",
+				})
+				*plan = nil
+				if err := c.Status().Update(ctx, obj); err != nil {
+					return reconcile.Result{}, fmt.Errorf("update status: %w", err)
+				}
+			}
+			return live.Reconcile(ctx, req)
+		}
+
+		planned := &Plan{}
+		result, err := sandboxed.Reconcile(withPlan(ctx, planned), req)
+		if err != nil {
+			return result, err
+		}
+		operations := planned.Operations()
+		log.FromContext(ctx).Info("changes planned", "operations", operations)
+		if obj.GetDeletionTimestamp() != nil {
+			// finalizer was removed by sandboxed reconciler, MinIO objects are kept
+			if d != nil && d.Recorder != nil && len(operations) > 0 {
+				d.Recorder.Event(obj, v1.EventTypeNormal, "Planned", "removal planned, MinIO objects are kept: "+strings.Join(operations, "; "))
+			}
+			return result, nil
+		}
+
+		conditions, plan := status(obj)
+		changed := strings.Join(*plan, "\n") != strings.Join(operations, "\n")
+		*plan = operations
+		condition := metav1.Condition{
+			Type:    miniov1alpha1.ConditionDryRun,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NoChanges",
+			Message: "MinIO is in sync",
+		}
+		if len(operations) > 0 {
+			condition.Reason = "Planned"
+			condition.Message = fmt.Sprintf("%d changes planned", len(operations))
+		}
+		meta.SetStatusCondition(conditions, condition)
+		if err := c.Status().Update(ctx, obj); err != nil {
+			return reconcile.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		if changed && len(operations) > 0 && d != nil && d.Recorder != nil {
+			d.Recorder.Event(obj, v1.EventTypeNormal, "Planned", condition.Message+": "+strings.Join(operations, "; "))
+		}
+		return result, nil
+	})
+}
+
+// sandbox returns Kubernetes client for dry-run reconciler. Reads are passed as is, writes are skipped (changes of
+// objects outside of the operator API group are added to the plan). Updates of removed resources of the operator API
+// group are passed, so finalizers are removed and the resource is deleted without changes in MinIO.
+func sandbox(c client.Client) client.Client {
+	return &sandboxClient{Client: c}
+}
+
+type sandboxClient struct {
+	client.Client
+}
+
+func (s *sandboxClient) record(ctx context.Context, action string, obj client.Object) {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return
+	}
+	gvk, err := apiutil.GVKForObject(obj, s.Scheme())
+	if err != nil || s.ownGroup(obj) {
+		return
+	}
+	plan.add("%s %s %s/%s", action, strings.ToLower(gvk.Kind), obj.GetNamespace(), obj.GetName())
+}
+
+func (s *sandboxClient) ownGroup(obj client.Object) bool {
+	gvk, err := apiutil.GVKForObject(obj, s.Scheme())
+	return err == nil && gvk.Group == miniov1alpha1.GroupVersion.Group
+}
+
+func (s *sandboxClient) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	s.record(ctx, "create", obj)
+	return nil
+}
+
+func (s *sandboxClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if obj.GetDeletionTimestamp() != nil && s.ownGroup(obj) {
+		return s.Client.Update(ctx, obj, opts...)
+	}
+	s.record(ctx, "update", obj)
+	return nil
+}
+
+func (s *sandboxClient) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	s.record(ctx, "update", obj)
+	return nil
+}
+
+func (s *sandboxClient) Delete(ctx context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	s.record(ctx, "delete", obj)
+	return nil
+}
+
+func (s *sandboxClient) DeleteAllOf(ctx context.Context, obj client.Object, _ ...client.DeleteAllOfOption) error {
+	s.record(ctx, "delete all", obj)
+	return nil
+}
+
+func (s *sandboxClient) Status() client.StatusWriter {
+	return discardStatus{}
+}
+
+type discardStatus struct{}
+
+func (discardStatus) Update(context.Context, client.Object, ...client.UpdateOption) error {
+	return nil
+}
+
+func (discardStatus) Patch(context.Context, client.Object, client.Patch, ...client.PatchOption) error {
+	return nil
+}
+
+// discardRecorder drops events of dry-run reconciler.
+type discardRecorder struct{}
+
+func (discardRecorder) Event(runtime.Object, string, string, string) {}
+
+func (discardRecorder) Eventf(runtime.Object, string, string, string, ...interface{}) {}
+
+func (discardRecorder) AnnotatedEventf(runtime.Object, map[string]string, string, string, string, ...interface{}) {
+}
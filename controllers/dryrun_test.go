@@ -0,0 +1,167 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func testScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(miniov1alpha1.AddToScheme(scheme))
+	return scheme
+}
+
+func TestSandboxClient(t *testing.T) {
+	now := metav1.Now()
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app-minio"}}
+	user := &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Finalizers: []string{userFinalizer}}}
+	deleted := &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "removed",
+		Finalizers: []string{userFinalizer}, DeletionTimestamp: &now}}
+
+	cases := []struct {
+		name     string
+		run      func(ctx context.Context, c client.Client) error
+		expected []string
+		// object and finalizers expected in the cluster after the call
+		check      client.Object
+		finalizers []string
+		removed    bool
+	}{
+		{
+			name: "create secret is planned",
+			run: func(ctx context.Context, c client.Client) error {
+				return c.Create(ctx, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "copy"}})
+			},
+			expected: []string{"create secret default/copy"},
+		},
+		{
+			name: "update secret is planned",
+			run: func(ctx context.Context, c client.Client) error {
+				updated := secret.DeepCopy()
+				updated.Data = map[string][]byte{"key": []byte("value")}
+				return c.Update(ctx, updated)
+			},
+			expected: []string{"update secret default/app-minio"},
+		},
+		{
+			name: "delete secret is planned",
+			run: func(ctx context.Context, c client.Client) error {
+				return c.Delete(ctx, secret.DeepCopy())
+			},
+			expected: []string{"delete secret default/app-minio"},
+			check:    secret.DeepCopy(),
+		},
+		{
+			name: "own resources are not planned",
+			run: func(ctx context.Context, c client.Client) error {
+				updated := user.DeepCopy()
+				updated.Finalizers = nil
+				if err := c.Update(ctx, updated); err != nil {
+					return err
+				}
+				return c.Status().Update(ctx, updated)
+			},
+			check:      user.DeepCopy(),
+			finalizers: []string{userFinalizer},
+		},
+		{
+			name: "finalizer of deleted resource is removed",
+			run: func(ctx context.Context, c client.Client) error {
+				updated := deleted.DeepCopy()
+				if err := c.Get(ctx, client.ObjectKeyFromObject(updated), updated); err != nil {
+					return err
+				}
+				updated.Finalizers = nil
+				return c.Update(ctx, updated)
+			},
+			check:   deleted.DeepCopy(),
+			removed: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			live := fake.NewClientBuilder().WithScheme(testScheme()).
+				WithObjects(secret.DeepCopy(), user.DeepCopy(), deleted.DeepCopy()).Build()
+			plan := &Plan{}
+			ctx := withPlan(context.Background(), plan)
+			if err := tc.run(ctx, sandbox(live)); err != nil {
+				t.Fatal(err)
+			}
+			if operations := plan.Operations(); !reflect.DeepEqual(operations, tc.expected) {
+				t.Errorf("expected operations %q, got %q", tc.expected, operations)
+			}
+			if tc.check != nil {
+				err := live.Get(ctx, client.ObjectKeyFromObject(tc.check), tc.check)
+				if tc.removed {
+					if !errors2.IsNotFound(err) {
+						t.Errorf("resource should be removed, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if finalizers := tc.check.GetFinalizers(); !reflect.DeepEqual(finalizers, tc.finalizers) {
+					t.Errorf("expected finalizers %v, got %v", tc.finalizers, finalizers)
+				}
+			}
+		})
+	}
+}
+
+func TestDryRun_Enabled(t *testing.T) {
+	cases := []struct {
+		name       string
+		all        bool
+		annotation string
+		expected   bool
+	}{
+		{name: "disabled"},
+		{name: "annotation", annotation: "true", expected: true},
+		{name: "other value is ignored", annotation: "yes"},
+		{name: "global", all: true, expected: true},
+		{name: "excluded from global", all: true, annotation: "false"},
+		{name: "other value with global", all: true, annotation: "1", expected: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := &miniov1alpha1.Bucket{}
+			if tc.annotation != "" {
+				bucket.Annotations = map[string]string{miniov1alpha1.DryRunAnnotation: tc.annotation}
+			}
+			dryRun := &DryRun{All: tc.all}
+			if enabled := dryRun.enabled(bucket); enabled != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, enabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// minioErrorCode returns code of MinIO error response or empty string.
+func minioErrorCode(err error) string {
+	var adminErr madmin.ErrorResponse
+	if errors.As(err, &adminErr) {
+		return adminErr.Code
+	}
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) {
+		return s3Err.Code
+	}
+	return ""
+}
+
+// recordError emits warning event (with MinIO error code if any) and returns the error as is.
+func recordError(recorder record.EventRecorder, obj runtime.Object, reason string, err error) error {
+	if code := minioErrorCode(err); code != "" {
+		recorder.Eventf(obj, v1.EventTypeWarning, reason, "%v (code: %s)", err, code)
+	} else {
+		recorder.Event(obj, v1.EventTypeWarning, reason, err.Error())
+	}
+	return err
+}
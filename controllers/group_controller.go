@@ -0,0 +1,387 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/minio/madmin-go"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+const groupFinalizer = "reddec.net.k8s.minio-group-finalizer"
+
+// GroupReconciler reconciles a Group object
+type GroupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Admin  AdminAPI
+	// Template for group names. If not set - DefaultGroupNameTemplate will be used.
+	GroupName *NameTemplate
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Timings of periodic reconciliation.
+	Resync Resync
+	// Global pause. Annotation pause works without it.
+	Pause *Pause
+	// Global dry-run. Annotation dry-run works without it.
+	DryRun *DryRun
+	// Namespaces to reconcile. Nil scope allows all namespaces.
+	Scope *Scope
+}
+
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=groups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=groups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=groups/finalizers,verbs=update
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.12.2/pkg/reconcile
+func (r *GroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var manifest = &miniov1alpha1.Group{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: req.Name}, manifest); err != nil {
+		if errors2.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("get manifest: %w", err)
+	}
+
+	check := r.Authorizer.CheckGroupPolicies(ctx, manifest.Namespace, manifest.Spec.Policies)
+	if check == nil {
+		check = r.Authorizer.CheckAdopt(ctx, manifest.Namespace, adoptedName(manifest))
+	}
+	allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, check)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// pause stops all changes in MinIO, including removal
+	paused, err := r.Pause.hold(ctx, manifest, &manifest.Status.Conditions)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
+	// removal
+	if manifest.GetDeletionTimestamp() != nil {
+		logger.Info("removing group", "group", manifest.Status.Name)
+		if !allowed {
+			logger.Info("not authorized, MinIO state is kept")
+		} else if err := r.removeGroup(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("remove group: %w", err)
+		}
+		controllerutil.RemoveFinalizer(manifest, groupFinalizer)
+		if err := r.Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !allowed {
+		logger.Info("not authorized by namespace rules")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
+	// add finalizer
+	if !controllerutil.ContainsFinalizer(manifest, groupFinalizer) {
+		controllerutil.AddFinalizer(manifest, groupFinalizer)
+		if err := r.Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// assign name once
+	if manifest.Status.Name == "" {
+		name, err := resolveName(manifest, r.groupNameTemplate())
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("group name: %w", err)
+		}
+		manifest.Status.Name = name
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+	}
+
+	// sync members
+	members, err := r.resolveMembers(ctx, manifest)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("resolve members: %w", err)
+	}
+	logger.Info("syncing members", "group", manifest.Status.Name, "members", len(members))
+	current, err := r.syncMembers(ctx, manifest.Status.Name, members)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("sync members: %w", err)
+	}
+
+	var status = madmin.GroupEnabled
+	if manifest.Spec.Disabled {
+		status = madmin.GroupDisabled
+	}
+	if current != status {
+		if err := r.Admin.SetGroupStatus(ctx, manifest.Status.Name, status); err != nil {
+			return ctrl.Result{}, fmt.Errorf("set group status: %w", err)
+		}
+	}
+
+	manifest.Status.Members = members
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.GroupConditionCreated,
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	// attach policies
+	logger.Info("assigning policies", "group", manifest.Status.Name)
+	if err := setGroupPolicies(ctx, r.Client, r.Admin, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("set policies: %w", err)
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.GroupConditionPolicyAssigned,
+		Status: metav1.ConditionTrue,
+		Reason: "Assigned",
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+}
+
+// resolveMembers returns sorted access keys of ready users referenced by group or matched by selector.
+func (r *GroupReconciler) resolveMembers(ctx context.Context, manifest *miniov1alpha1.Group) ([]string, error) {
+	var list miniov1alpha1.UserList
+	if err := r.List(ctx, &list, client.InNamespace(manifest.Namespace)); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	var refs = make(map[string]bool, len(manifest.Spec.Members))
+	for _, ref := range manifest.Spec.Members {
+		refs[ref.Name] = true
+	}
+
+	var selector = labels.Nothing()
+	if manifest.Spec.Selector != nil {
+		s, err := metav1.LabelSelectorAsSelector(manifest.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("parse selector: %w", err)
+		}
+		selector = s
+	}
+
+	var members []string
+	for _, user := range list.Items {
+		if user.GetDeletionTimestamp() != nil || !user.IsReady() {
+			continue
+		}
+		if refs[user.Name] || selector.Matches(labels.Set(user.Labels)) {
+			members = append(members, user.AccessKey())
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// syncMembers creates group if needed and sets members. Returns status of the group in MinIO.
+func (r *GroupReconciler) syncMembers(ctx context.Context, group string, members []string) (madmin.GroupStatus, error) {
+	var current []string
+	var status = madmin.GroupEnabled // new groups are enabled
+	info, err := r.Admin.GetGroupDescription(ctx, group)
+	if err == nil {
+		current = info.Members
+		status = madmin.GroupStatus(info.Status)
+	} else if !isNoSuchGroup(err) {
+		return "", fmt.Errorf("get group: %w", err)
+	}
+
+	var expected = make(map[string]bool, len(members))
+	for _, m := range members {
+		expected[m] = true
+	}
+	var toRemove []string
+	for _, m := range current {
+		if !expected[m] {
+			toRemove = append(toRemove, m)
+		}
+		delete(expected, m)
+	}
+	var toAdd = make([]string, 0, len(expected))
+	for m := range expected {
+		toAdd = append(toAdd, m)
+	}
+
+	// add also creates group if needed
+	if len(toAdd) > 0 || info == nil {
+		if err := r.Admin.UpdateGroupMembers(ctx, madmin.GroupAddRemove{Group: group, Members: toAdd}); err != nil {
+			return "", fmt.Errorf("add members: %w", err)
+		}
+	}
+	if len(toRemove) > 0 {
+		if err := r.Admin.UpdateGroupMembers(ctx, madmin.GroupAddRemove{Group: group, Members: toRemove, IsRemove: true}); err != nil {
+			return "", fmt.Errorf("remove members: %w", err)
+		}
+	}
+	return status, nil
+}
+
+func (r *GroupReconciler) removeGroup(ctx context.Context, manifest *miniov1alpha1.Group) error {
+	if manifest.Status.Name == "" {
+		// group was never created
+		return nil
+	}
+	info, err := r.Admin.GetGroupDescription(ctx, manifest.Status.Name)
+	if isNoSuchGroup(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get group: %w", err)
+	}
+	// group can be removed only without members
+	if len(info.Members) > 0 {
+		err = r.Admin.UpdateGroupMembers(ctx, madmin.GroupAddRemove{Group: manifest.Status.Name, Members: info.Members, IsRemove: true})
+		if err != nil {
+			return fmt.Errorf("remove members: %w", err)
+		}
+	}
+	err = r.Admin.UpdateGroupMembers(ctx, madmin.GroupAddRemove{Group: manifest.Status.Name, IsRemove: true})
+	if err != nil && !isNoSuchGroup(err) {
+		return fmt.Errorf("remove group: %w", err)
+	}
+	return nil
+}
+
+func (r *GroupReconciler) groupNameTemplate() *NameTemplate {
+	if r.GroupName != nil {
+		return r.GroupName
+	}
+	return defaultGroupName
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&miniov1alpha1.Group{}).
+		Watches(&source.Kind{Type: &miniov1alpha1.User{}}, handler.EnqueueRequestsFromMapFunc(r.groupsInNamespace)).
+		Watches(&source.Kind{Type: &miniov1alpha1.Policy{}}, handler.EnqueueRequestsFromMapFunc(r.groupOfPolicy))
+	builder = r.Scope.watch(builder, r.Client, func() client.ObjectList {
+		return &miniov1alpha1.GroupList{}
+	})
+	sandboxed := *r
+	sandboxed.Client = sandbox(r.Client)
+	return completeWithBackoff(builder, r.Scope.wrap(r.DryRun.wrap(r.Client, r, &sandboxed, func() client.Object {
+		return &miniov1alpha1.Group{}
+	}, func(obj client.Object) (*[]metav1.Condition, *[]string) {
+		status := &obj.(*miniov1alpha1.Group).Status
+		return &status.Conditions, &status.Plan
+	})))
+}
+
+// groupsInNamespace enqueues all groups from the same namespace since any of them may select the user by labels.
+func (r *GroupReconciler) groupsInNamespace(object client.Object) []reconcile.Request {
+	var list miniov1alpha1.GroupList
+	if err := r.List(context.Background(), &list, client.InNamespace(object.GetNamespace())); err != nil {
+		log.Log.Error(err, "failed to list groups", "namespace", object.GetNamespace())
+		return nil
+	}
+	var requests = make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
+}
+
+func (r *GroupReconciler) groupOfPolicy(object client.Object) []reconcile.Request {
+	ref := object.(*miniov1alpha1.Policy).Spec.GroupRef
+	if ref == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: object.GetNamespace(), Name: ref.Name}}}
+}
+
+// setGroupPolicies attaches to the group policies from spec and all created Policy resources referencing the group.
+// MinIO replaces whole set of policies on each call, so the full list is always computed.
+// Extra policies are attached as well (cache may not yet contain recently created policy).
+// Policies are written only if they differ from MinIO.
+func setGroupPolicies(ctx context.Context, c client.Client, admin AdminAPI, group *miniov1alpha1.Group, extra ...string) error {
+	var list miniov1alpha1.PolicyList
+	if err := c.List(ctx, &list, client.InNamespace(group.Namespace), client.MatchingFields{policyGroupRefField: group.Name}); err != nil {
+		return fmt.Errorf("list policies: %w", err)
+	}
+	var names = make(map[string]bool)
+	for _, name := range group.Spec.Policies {
+		names[name] = true
+	}
+	for _, name := range extra {
+		names[name] = true
+	}
+	for _, item := range list.Items {
+		if item.GetDeletionTimestamp() != nil || !item.IsCreated() {
+			continue
+		}
+		names[item.Status.Name] = true
+	}
+	var policies = make([]string, 0, len(names))
+	for name := range names {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+	info, err := admin.GetGroupDescription(ctx, group.Status.Name)
+	if err != nil {
+		return fmt.Errorf("get group: %w", err)
+	}
+	current := splitPolicies(info.Policy)
+	sort.Strings(current)
+	if strings.Join(current, ",") == strings.Join(policies, ",") {
+		return nil
+	}
+	return admin.SetPolicy(ctx, strings.Join(policies, ","), group.Status.Name, true)
+}
+
+func isNoSuchGroup(err error) bool {
+	merr, ok := err.(madmin.ErrorResponse)
+	return ok && merr.Code == "XMinioAdminNoSuchGroup"
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/validate-minio-k8s-reddec-net-v1alpha1-group,mutating=false,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=groups,verbs=create;update,versions=v1alpha1,name=vgroup.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// GroupValidator validates Group resources on admission.
+type GroupValidator struct {
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (v *GroupValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.Group{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *GroupValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(ctx, obj.(*miniov1alpha1.Group))
+}
+
+// ValidateUpdate checks the same rules as on creation, since namespace rules may have changed since creation.
+func (v *GroupValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return v.validate(ctx, newObj.(*miniov1alpha1.Group))
+}
+
+func (v *GroupValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *GroupValidator) validate(ctx context.Context, manifest *miniov1alpha1.Group) error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if manifest.Spec.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(manifest.Spec.Selector); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("selector"), manifest.Spec.Selector, err.Error()))
+		}
+	}
+	for i, policy := range manifest.Spec.Policies {
+		if policy == "" {
+			errs = append(errs, field.Required(spec.Child("policies").Index(i), "policy name should be set"))
+		}
+	}
+	errs = append(errs, validateAdopt(manifest)...)
+	check := v.Authorizer.CheckGroupPolicies(ctx, manifest.Namespace, manifest.Spec.Policies)
+	if check == nil {
+		check = v.Authorizer.CheckAdopt(ctx, manifest.Namespace, adoptedName(manifest))
+	}
+	denied, err := authorizationError(check)
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		errs = append(errs, denied)
+	}
+	return invalid("Group", manifest.Name, errs)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultProbeBucket is checked by BucketExists. Bucket may not exist: the call verifies connectivity and credentials.
+const DefaultProbeBucket = "minio-ext-operator-probe"
+
+var connectionUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "connection_up",
+	Help:      "Result of last health check of MinIO connection (1 - healthy).",
+}, []string{"connection"})
+
+var errNotChecked = errors.New("not checked yet")
+
+// HealthChecker periodically checks MinIO connection by admin and S3 clients. Probes use cached result, so
+// MinIO is not called on each probe.
+type HealthChecker struct {
+	// Name of MinIO connection.
+	Connection  string
+	Admin       *madmin.AdminClient
+	Minio       *minio.Client
+	ProbeBucket string
+	Interval    time.Duration
+
+	lock    sync.RWMutex
+	lastErr error
+}
+
+// Start checks connection till context is done. Implements manager.Runnable.
+func (h *HealthChecker) Start(ctx context.Context) error {
+	h.setResult(errNotChecked)
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	for {
+		h.setResult(h.check(ctx))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false: readiness is checked on every replica.
+func (h *HealthChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// Check returns result of last check. Implements healthz.Checker.
+func (h *HealthChecker) Check(_ *http.Request) error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if h.lastErr != nil {
+		return fmt.Errorf("connection %s: %w", h.Connection, h.lastErr)
+	}
+	return nil
+}
+
+func (h *HealthChecker) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Interval)
+	defer cancel()
+	if _, err := h.Admin.ServerInfo(ctx); err != nil {
+		return fmt.Errorf("get server info: %w", err)
+	}
+	if _, err := h.Minio.BucketExists(ctx, h.ProbeBucket); err != nil {
+		return fmt.Errorf("check bucket %s: %w", h.ProbeBucket, err)
+	}
+	return nil
+}
+
+func (h *HealthChecker) setResult(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	logger := ctrl.Log.WithName("health").WithValues("connection", h.Connection)
+	switch {
+	case err == nil && h.lastErr != nil:
+		logger.Info("connection is healthy")
+	case err != nil && !errors.Is(err, errNotChecked) && (h.lastErr == nil || h.lastErr.Error() != err.Error()):
+		logger.Error(err, "connection is not healthy")
+	}
+	h.lastErr = err
+	if err == nil {
+		connectionUp.WithLabelValues(h.Connection).Set(1)
+	} else {
+		connectionUp.WithLabelValues(h.Connection).Set(0)
+	}
+}
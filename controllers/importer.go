@@ -0,0 +1,319 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// builtinPolicies are canned policies created by MinIO itself.
+var builtinPolicies = []string{"readonly", "readwrite", "writeonly", "diagnostics", "consoleAdmin"}
+
+// Imported is resource generated from existing MinIO object.
+type Imported struct {
+	Object client.Object
+	// Notes about parts of MinIO object which are not managed by operator or require manual steps.
+	Notes []string
+}
+
+// Importer generates resources for existing buckets, users, groups and canned policies, so the operator can take
+// them over without recreating. Resources are annotated by AdoptAnnotation and optionally by DryRunAnnotation.
+type Importer struct {
+	Admin *madmin.AdminClient
+	Minio *minio.Client
+	// Namespace of generated resources.
+	Namespace string
+	// Add DryRunAnnotation, so changes are only planned till the annotation is removed.
+	DryRun bool
+}
+
+// Import lists MinIO objects and returns resources (buckets, users, groups, policies) and notes about objects which
+// were not imported.
+func (im *Importer) Import(ctx context.Context) ([]Imported, []string, error) {
+	var result []Imported
+	var notes []string
+
+	buckets, bucketNames, err := im.importBuckets(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	result = append(result, buckets...)
+
+	users, err := im.Admin.ListUsers(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list users: %w", err)
+	}
+	groups, err := im.Admin.ListGroups(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list groups: %w", err)
+	}
+	sort.Strings(groups)
+	var groupInfo = make(map[string]*madmin.GroupDesc, len(groups))
+	for _, group := range groups {
+		desc, err := im.Admin.GetGroupDescription(ctx, group)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get group %s: %w", group, err)
+		}
+		groupInfo[group] = desc
+	}
+	cannedPolicies, err := im.Admin.ListCannedPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list canned policies: %w", err)
+	}
+
+	// policy can be taken over by Policy resource only if it is attached to the single user
+	var attachments = make(map[string]int)
+	for _, info := range users {
+		for _, name := range splitPolicies(info.PolicyName) {
+			attachments[name]++
+		}
+	}
+	for _, desc := range groupInfo {
+		for _, name := range splitPolicies(desc.Policy) {
+			attachments[name]++
+		}
+	}
+
+	var accessKeys = make([]string, 0, len(users))
+	for accessKey := range users {
+		accessKeys = append(accessKeys, accessKey)
+	}
+	sort.Strings(accessKeys)
+
+	var userNames = uniqueNames{}
+	var policyNames = uniqueNames{}
+	var userResources = make(map[string]string, len(users)) // access key -> resource name
+	var managedPolicies = make(map[string]bool)
+	var policies []Imported
+	for _, accessKey := range accessKeys {
+		info := users[accessKey]
+		user := &miniov1alpha1.User{
+			ObjectMeta: im.objectMeta(userNames.next(accessKey), accessKey),
+			Spec: miniov1alpha1.UserSpec{
+				AccessKey: accessKey,
+				Disabled:  info.Status == madmin.AccountDisabled,
+			},
+		}
+		// secret key can not be read from MinIO: user is not changed till credentials secret is created
+		user.Spec.CredentialsFrom = &miniov1alpha1.CredentialsSource{Name: user.Name + "-credentials"}
+		userResources[accessKey] = user.Name
+		imported := Imported{Object: user, Notes: []string{
+			"create secret " + user.Spec.CredentialsFrom.Name + " with current secret key in " + secretSecretAccessKey,
+		}}
+
+		for _, name := range splitPolicies(info.PolicyName) {
+			spec, ok := importPolicySpec(cannedPolicies[name])
+			if !ok || attachments[name] != 1 || contains(builtinPolicies, name) {
+				imported.Notes = append(imported.Notes, "policy "+name+" is not managed by operator")
+				continue
+			}
+			spec.UserRef = &corev1.LocalObjectReference{Name: user.Name}
+			if bucketNames[spec.Bucket] {
+				spec.BucketRef = &corev1.LocalObjectReference{Name: spec.Bucket}
+				spec.Bucket = ""
+			}
+			managedPolicies[name] = true
+			policies = append(policies, Imported{Object: &miniov1alpha1.Policy{
+				ObjectMeta: im.objectMeta(policyNames.next(name), name),
+				Spec:       spec,
+			}})
+		}
+		result = append(result, imported)
+	}
+
+	var groupNames = uniqueNames{}
+	for _, group := range groups {
+		desc := groupInfo[group]
+		resource := &miniov1alpha1.Group{
+			ObjectMeta: im.objectMeta(groupNames.next(group), group),
+			Spec: miniov1alpha1.GroupSpec{
+				Policies: splitPolicies(desc.Policy),
+				Disabled: desc.Status == string(madmin.GroupDisabled),
+			},
+		}
+		imported := Imported{Object: resource, Notes: []string{
+			"members are added to the group only when their users are ready",
+		}}
+		for _, member := range desc.Members {
+			if name, ok := userResources[member]; ok {
+				resource.Spec.Members = append(resource.Spec.Members, corev1.LocalObjectReference{Name: name})
+			} else {
+				imported.Notes = append(imported.Notes, "member "+member+" is not imported and will be removed from the group")
+			}
+		}
+		result = append(result, imported)
+	}
+	result = append(result, policies...)
+
+	var cannedNames = make([]string, 0, len(cannedPolicies))
+	for name := range cannedPolicies {
+		cannedNames = append(cannedNames, name)
+	}
+	sort.Strings(cannedNames)
+	for _, name := range cannedNames {
+		if !managedPolicies[name] && !contains(builtinPolicies, name) && attachments[name] == 0 {
+			notes = append(notes, "canned policy "+name+" is not attached and not imported")
+		}
+	}
+	return result, notes, nil
+}
+
+func (im *Importer) importBuckets(ctx context.Context) ([]Imported, map[string]bool, error) {
+	buckets, err := im.Minio.ListBuckets(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list buckets: %w", err)
+	}
+	var names = make(map[string]bool, len(buckets))
+	var result = make([]Imported, 0, len(buckets))
+	for _, info := range buckets {
+		bucket := &miniov1alpha1.Bucket{
+			ObjectMeta: im.objectMeta(info.Name, info.Name),
+			// bucket with data should not be removed with resource
+			Spec: miniov1alpha1.BucketSpec{Retain: true},
+		}
+		var notes []string
+
+		current, err := im.Minio.GetBucketPolicy(ctx, info.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get policy of bucket %s: %w", info.Name, err)
+		}
+		if current != "" {
+			public := &miniov1alpha1.Bucket{ObjectMeta: metav1.ObjectMeta{Name: info.Name}, Spec: miniov1alpha1.BucketSpec{Public: true}}
+			diff, err := policyDiff([]byte(mustPolicy(public)), []byte(current), true)
+			if err != nil {
+				return nil, nil, fmt.Errorf("compare policy of bucket %s: %w", info.Name, err)
+			}
+			if diff == "" {
+				bucket.Spec.Public = true
+			} else {
+				notes = append(notes, "custom bucket policy will be replaced by operator: "+current)
+			}
+		}
+
+		versioning, err := im.Minio.GetBucketVersioning(ctx, info.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get versioning of bucket %s: %w", info.Name, err)
+		}
+		if versioning.Status != "" {
+			notes = append(notes, "versioning "+versioning.Status+" is not managed by operator")
+		}
+
+		lifecycle, err := im.Minio.GetBucketLifecycle(ctx, info.Name)
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return nil, nil, fmt.Errorf("get lifecycle of bucket %s: %w", info.Name, err)
+		}
+		if err == nil && lifecycle != nil && len(lifecycle.Rules) > 0 {
+			notes = append(notes, strconv.Itoa(len(lifecycle.Rules))+" lifecycle rules are not managed by operator")
+		}
+
+		names[info.Name] = true
+		result = append(result, Imported{Object: bucket, Notes: notes})
+	}
+	return result, names, nil
+}
+
+func (im *Importer) objectMeta(name, minioName string) metav1.ObjectMeta {
+	annotations := map[string]string{miniov1alpha1.AdoptAnnotation: minioName}
+	if im.DryRun {
+		annotations[miniov1alpha1.DryRunAnnotation] = "true"
+	}
+	return metav1.ObjectMeta{Name: name, Namespace: im.Namespace, Annotations: annotations}
+}
+
+// importPolicySpec returns spec of Policy resource which generates the same canned policy.
+func importPolicySpec(document []byte) (miniov1alpha1.PolicySpec, bool) {
+	bucket, ok := policyBucket(document)
+	if !ok {
+		return miniov1alpha1.PolicySpec{}, false
+	}
+	for _, spec := range []miniov1alpha1.PolicySpec{
+		{Bucket: bucket, Read: true, Write: true},
+		{Bucket: bucket, Read: true},
+		{Bucket: bucket, Write: true},
+	} {
+		// principals are not kept in canned policies
+		expected := mustIAMPolicy(&miniov1alpha1.Policy{Spec: spec}, "*", bucket)
+		if diff, err := policyDiff(expected, document, false); err == nil && diff == "" {
+			return spec, true
+		}
+	}
+	return miniov1alpha1.PolicySpec{}, false
+}
+
+// policyBucket returns bucket of policy with single statement for objects of the bucket.
+func policyBucket(document []byte) (string, bool) {
+	statements, err := policyStatements(document, false)
+	if err != nil || len(statements) != 1 {
+		return "", false
+	}
+	_, resources := policyItems(statements)
+	if len(resources) != 1 {
+		return "", false
+	}
+	bucket := strings.TrimPrefix(resources[0], "arn:aws:s3:::")
+	if !strings.HasSuffix(bucket, "/*") {
+		return "", false
+	}
+	return strings.TrimSuffix(bucket, "/*"), true
+}
+
+// uniqueNames converts MinIO names to unique names of Kubernetes resources.
+type uniqueNames map[string]bool
+
+func (un uniqueNames) next(minioName string) string {
+	base := kubeName(minioName)
+	name := base
+	for i := 2; un[name]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	un[name] = true
+	return name
+}
+
+// kubeName converts MinIO name to valid name of Kubernetes resource.
+func kubeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, name)
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	name = strings.Trim(name, "-.")
+	if name == "" {
+		return "imported"
+	}
+	return name
+}
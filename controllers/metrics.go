@@ -0,0 +1,267 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+const metricsNamespace = "minio_operator"
+
+var (
+	minioRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of requests to MinIO API by operation, result and error code.",
+	}, []string{"operation", "result", "code"})
+	minioRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to MinIO API by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(minioRequests, minioRequestDuration, connectionUp)
+}
+
+// InstrumentTransport wraps transport of MinIO clients to collect metrics of requests.
+func InstrumentTransport(base http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{base: base}
+}
+
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := minioOperation(req)
+	started := time.Now()
+	res, err := t.base.RoundTrip(req)
+	minioRequestDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+	if err != nil {
+		minioRequests.WithLabelValues(operation, "error", "NetworkError").Inc()
+		return res, err
+	}
+	if res.StatusCode < http.StatusBadRequest {
+		minioRequests.WithLabelValues(operation, "success", "").Inc()
+		return res, nil
+	}
+	minioRequests.WithLabelValues(operation, "error", responseErrorCode(res)).Inc()
+	return res, nil
+}
+
+// known S3 sub-resources used in operation names
+var s3SubResources = []string{"policy", "location", "versioning", "lifecycle", "object-lock", "tagging",
+	"encryption", "notification", "replication"}
+
+// minioOperation returns low-cardinality name of operation: admin:<api> for admin API and
+// s3:<method>:<bucket|object>[?sub-resource] for S3 API.
+func minioOperation(req *http.Request) string {
+	const adminPrefix = "/minio/admin/"
+	if path := req.URL.Path; strings.HasPrefix(path, adminPrefix) {
+		// /minio/admin/v3/<api>
+		parts := strings.SplitN(strings.TrimPrefix(path, adminPrefix), "/", 3)
+		return "admin:" + parts[len(parts)-1]
+	}
+	path := strings.Trim(req.URL.Path, "/")
+	level := "object"
+	switch {
+	case path == "":
+		level = "service"
+	case !strings.Contains(path, "/"):
+		level = "bucket"
+	}
+	operation := "s3:" + req.Method + ":" + level
+	query := req.URL.Query()
+	for _, sub := range s3SubResources {
+		if _, ok := query[sub]; ok {
+			return operation + "?" + sub
+		}
+	}
+	return operation
+}
+
+// responseErrorCode parses error code from MinIO response (JSON for admin API, XML for S3 API). Body is restored.
+func responseErrorCode(res *http.Response) string {
+	const maxErrorBody = 64 * 1024
+	if res.Body == nil {
+		return strconv.Itoa(res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil || len(data) == 0 {
+		return strconv.Itoa(res.StatusCode)
+	}
+	var body struct {
+		Code string `json:"Code" xml:"Code"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Code != "" {
+		return body.Code
+	}
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return body.Code
+	}
+	return strconv.Itoa(res.StatusCode)
+}
+
+var (
+	managedResourcesDesc = prometheus.NewDesc(metricsNamespace+"_managed_resources",
+		"Number of managed resources by kind and readiness.", []string{"kind", "ready"}, nil)
+	bucketUsageDesc = prometheus.NewDesc(metricsNamespace+"_bucket_usage_bytes",
+		"Size of managed bucket by MinIO data usage.", []string{"namespace", "name", "bucket"}, nil)
+	credentialsAgeDesc = prometheus.NewDesc(metricsNamespace+"_user_credentials_age_seconds",
+		"Time since last credentials rotation (or creation) of user.", []string{"namespace", "name"}, nil)
+)
+
+// collectTimeout limits time of collecting metrics of managed resources.
+const collectTimeout = 10 * time.Second
+
+// usageCacheTTL limits requests of data usage: MinIO scans usage periodically, so frequent requests give nothing new.
+const usageCacheTTL = time.Minute
+
+// ResourceCollector exposes state of managed resources at scrape time. Data usage is cached for usageCacheTTL.
+type ResourceCollector struct {
+	Reader client.Reader
+	Admin  *madmin.AdminClient
+
+	lock      sync.Mutex
+	checkedAt time.Time
+	usage     map[string]uint64 // bucket -> size
+}
+
+func (c *ResourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedResourcesDesc
+	ch <- bucketUsageDesc
+	ch <- credentialsAgeDesc
+}
+
+func (c *ResourceCollector) Collect(ch chan<- prometheus.Metric) {
+	logger := ctrl.Log.WithName("metrics")
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	var buckets miniov1alpha1.BucketList
+	if err := c.Reader.List(ctx, &buckets); err != nil {
+		logger.Error(err, "list buckets")
+	} else {
+		var ready = make([]bool, 0, len(buckets.Items))
+		for _, bucket := range buckets.Items {
+			ready = append(ready, bucket.IsReady())
+		}
+		collectReadiness(ch, "Bucket", ready)
+		c.collectUsage(ctx, ch, buckets.Items)
+	}
+
+	var users miniov1alpha1.UserList
+	if err := c.Reader.List(ctx, &users); err != nil {
+		logger.Error(err, "list users")
+	} else {
+		var ready = make([]bool, 0, len(users.Items))
+		for _, user := range users.Items {
+			ready = append(ready, user.IsReady())
+			if last := user.Status.LastRotated; last != nil {
+				ch <- prometheus.MustNewConstMetric(credentialsAgeDesc, prometheus.GaugeValue,
+					time.Since(last.Time).Seconds(), user.Namespace, user.Name)
+			}
+		}
+		collectReadiness(ch, "User", ready)
+	}
+
+	var policies miniov1alpha1.PolicyList
+	if err := c.Reader.List(ctx, &policies); err != nil {
+		logger.Error(err, "list policies")
+	} else {
+		var ready = make([]bool, 0, len(policies.Items))
+		for _, policy := range policies.Items {
+			ready = append(ready, meta.IsStatusConditionTrue(policy.Status.Conditions, miniov1alpha1.PolicyConditionAssigned))
+		}
+		collectReadiness(ch, "Policy", ready)
+	}
+}
+
+func (c *ResourceCollector) collectUsage(ctx context.Context, ch chan<- prometheus.Metric, buckets []miniov1alpha1.Bucket) {
+	if len(buckets) == 0 {
+		return
+	}
+	usage := c.bucketsUsage(ctx)
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].BucketName() < buckets[j].BucketName()
+	})
+	for _, bucket := range buckets {
+		size, ok := usage[bucket.BucketName()]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(bucketUsageDesc, prometheus.GaugeValue, float64(size),
+			bucket.Namespace, bucket.Name, bucket.BucketName())
+	}
+}
+
+// bucketsUsage returns cached sizes of buckets. On error previous values are kept till next attempt after TTL.
+func (c *ResourceCollector) bucketsUsage(ctx context.Context) map[string]uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if time.Since(c.checkedAt) < usageCacheTTL {
+		return c.usage
+	}
+	c.checkedAt = time.Now()
+	info, err := c.Admin.DataUsageInfo(ctx)
+	if err != nil {
+		ctrl.Log.WithName("metrics").Error(err, "get data usage")
+		return c.usage
+	}
+	var usage = make(map[string]uint64, len(info.BucketsUsage))
+	for name, bucket := range info.BucketsUsage {
+		usage[name] = bucket.Size
+	}
+	c.usage = usage
+	return usage
+}
+
+func collectReadiness(ch chan<- prometheus.Metric, kind string, ready []bool) {
+	var total, readyCount int
+	for _, ok := range ready {
+		total++
+		if ok {
+			readyCount++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(managedResourcesDesc, prometheus.GaugeValue, float64(readyCount), kind, "true")
+	ch <- prometheus.MustNewConstMetric(managedResourcesDesc, prometheus.GaugeValue, float64(total-readyCount), kind, "false")
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// DefaultPolicyNameTemplate used for canned policies names in MinIO. MinIO policies are global, so namespace is
+// part of the name.
+const DefaultPolicyNameTemplate = "{{.Namespace}}-{{.Name}}"
+
+// DefaultGroupNameTemplate used for group names in MinIO.
+const DefaultGroupNameTemplate = "{{.Namespace}}-{{.Name}}"
+
+// DefaultUserNameTemplate used for user names (access keys) in MinIO if not set explicitly. MinIO users are global,
+// so namespace is part of the name. Users created by previous versions keep resource name.
+const DefaultUserNameTemplate = "{{.Namespace}}-{{.Name}}"
+
+var (
+	defaultPolicyName = MustNameTemplate(DefaultPolicyNameTemplate)
+	defaultGroupName  = MustNameTemplate(DefaultGroupNameTemplate)
+	defaultUserName   = MustNameTemplate(DefaultUserNameTemplate)
+)
+
+// NameTemplate renders names of MinIO objects from kubernetes resources.
+// Template receives Namespace and Name of the resource.
+type NameTemplate struct {
+	tpl *template.Template
+}
+
+// ParseNameTemplate parses Go template used to derive MinIO names.
+func ParseNameTemplate(text string) (*NameTemplate, error) {
+	tpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse name template: %w", err)
+	}
+	return &NameTemplate{tpl: tpl}, nil
+}
+
+// MustNameTemplate is same as ParseNameTemplate but panics on error.
+func MustNameTemplate(text string) *NameTemplate {
+	tpl, err := ParseNameTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return tpl
+}
+
+// Render name for the object.
+func (nt *NameTemplate) Render(obj client.Object) (string, error) {
+	var out strings.Builder
+	err := nt.tpl.Execute(&out, struct {
+		Namespace string
+		Name      string
+	}{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("render name: %w", err)
+	}
+	name := strings.TrimSpace(out.String())
+	if name == "" {
+		return "", errors.New("rendered name is empty")
+	}
+	return name, nil
+}
+
+// resolveName returns name of existing MinIO object from AdoptAnnotation or renders name by template.
+func resolveName(obj client.Object, nt *NameTemplate) (string, error) {
+	if name := adoptedName(obj); name != "" {
+		if contains(builtinPolicies, name) {
+			return "", fmt.Errorf("built-in policy %s can not be adopted", name)
+		}
+		return name, nil
+	}
+	return nt.Render(obj)
+}
+
+// adoptedName returns name of existing MinIO object from AdoptAnnotation or empty string.
+func adoptedName(obj client.Object) string {
+	return strings.TrimSpace(obj.GetAnnotations()[miniov1alpha1.AdoptAnnotation])
+}
+
+// validateAccessKey checks MinIO constraints for user access key.
+func validateAccessKey(accessKey string) error {
+	if len(accessKey) < 3 {
+		return fmt.Errorf("access key %q should be at least 3 characters", accessKey)
+	}
+	if strings.ContainsAny(accessKey, "=,") {
+		return fmt.Errorf("access key %q should not contain '=' or ','", accessKey)
+	}
+	return nil
+}
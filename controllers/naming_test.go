@@ -0,0 +1,153 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func TestNameTemplate_Render(t *testing.T) {
+	policy := &miniov1alpha1.Policy{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "reader"}}
+	cases := []struct {
+		name     string
+		template string
+		expected string
+		fail     bool
+	}{
+		{name: "default policy", template: DefaultPolicyNameTemplate, expected: "team-a-reader"},
+		{name: "default user", template: DefaultUserNameTemplate, expected: "team-a-reader"},
+		{name: "spaces are trimmed", template: " {{.Name}}\n", expected: "reader"},
+		{name: "empty result", template: "{{if false}}x{{end}}", fail: true},
+		{name: "unknown field", template: "{{.Kind}}", fail: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tpl, err := ParseNameTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, err := tpl.Render(policy)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected error, got name %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestParseNameTemplate_Invalid(t *testing.T) {
+	if _, err := ParseNameTemplate("{{.Name"); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+	}{
+		{name: "template", expected: "team-a-writers"},
+		{name: "adopted", annotations: map[string]string{miniov1alpha1.AdoptAnnotation: "legacy-group"}, expected: "legacy-group"},
+		{name: "adopted with spaces", annotations: map[string]string{miniov1alpha1.AdoptAnnotation: " legacy-group "}, expected: "legacy-group"},
+		{name: "empty adopt annotation", annotations: map[string]string{miniov1alpha1.AdoptAnnotation: " "}, expected: "team-a-writers"},
+		{name: "built-in policy", annotations: map[string]string{miniov1alpha1.AdoptAnnotation: "consoleAdmin"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			group := &miniov1alpha1.Group{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "team-a",
+				Name:        "writers",
+				Annotations: tc.annotations,
+			}}
+			name, err := resolveName(group, defaultGroupName)
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected error, got %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestValidateAccessKey(t *testing.T) {
+	cases := []struct {
+		accessKey string
+		valid     bool
+	}{
+		{accessKey: "app-user", valid: true},
+		{accessKey: "ab"},
+		{accessKey: "a=b"},
+		{accessKey: "a,b,c"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.accessKey, func(t *testing.T) {
+			err := validateAccessKey(tc.accessKey)
+			if tc.valid != (err == nil) {
+				t.Errorf("valid %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestResolveAccessKey(t *testing.T) {
+	user := func(spec miniov1alpha1.UserSpec, finalizers ...string) *miniov1alpha1.User {
+		return &miniov1alpha1.User{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app", Finalizers: finalizers},
+			Spec:       spec,
+		}
+	}
+	cases := []struct {
+		name     string
+		user     *miniov1alpha1.User
+		expected string
+	}{
+		{name: "default", user: user(miniov1alpha1.UserSpec{}), expected: "team-a-app"},
+		{name: "explicit", user: user(miniov1alpha1.UserSpec{AccessKey: "custom"}), expected: "custom"},
+		{name: "created by previous version", user: user(miniov1alpha1.UserSpec{}, userFinalizer), expected: "app"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			accessKey, err := resolveAccessKey(tc.user, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accessKey != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, accessKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// PauseKey in ConfigMap pauses all resources if set to "true".
+const PauseKey = "paused"
+
+// pauseCacheTTL limits requests of pause ConfigMap.
+const pauseCacheTTL = 10 * time.Second
+
+// Pause stops changes in MinIO for resources with PausedAnnotation or for all resources (except resources with
+// the annotation set to "false"). Nil pause handles only annotation.
+type Pause struct {
+	// Pause all resources.
+	All bool
+	// ConfigMap with PauseKey. Optional.
+	ConfigMap client.ObjectKey
+	// Uncached reader for ConfigMap.
+	Reader client.Reader
+
+	lock      sync.Mutex
+	checkedAt time.Time
+	global    bool
+}
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+
+// annotationSwitch returns state of boolean annotation: "true" or "false". Other values are ignored (set is false),
+// so operator-level default is used.
+func annotationSwitch(obj client.Object, name string) (enabled, set bool) {
+	switch obj.GetAnnotations()[name] {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// hold reflects pause in condition. Returns true if reconciliation should stop. Status is not saved.
+func (p *Pause) hold(ctx context.Context, obj client.Object, conditions *[]metav1.Condition) (bool, error) {
+	var reason, message string
+	if paused, set := annotationSwitch(obj, miniov1alpha1.PausedAnnotation); set {
+		if paused {
+			reason, message = "Annotation", "paused by annotation "+miniov1alpha1.PausedAnnotation
+		}
+	} else if global, err := p.globalPause(ctx); err != nil {
+		return false, err
+	} else if global {
+		reason, message = "Global", "operator is paused"
+	}
+
+	if reason != "" {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:    miniov1alpha1.ConditionPaused,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		})
+		return true, nil
+	}
+	if meta.FindStatusCondition(*conditions, miniov1alpha1.ConditionPaused) != nil {
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:   miniov1alpha1.ConditionPaused,
+			Status: metav1.ConditionFalse,
+			Reason: "Resumed",
+		})
+	}
+	return false, nil
+}
+
+func (p *Pause) globalPause(ctx context.Context) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	if p.All {
+		return true, nil
+	}
+	if p.ConfigMap.Name == "" {
+		return false, nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if time.Since(p.checkedAt) < pauseCacheTTL {
+		return p.global, nil
+	}
+	var cm v1.ConfigMap
+	err := p.Reader.Get(ctx, p.ConfigMap, &cm)
+	if err != nil && !errors2.IsNotFound(err) {
+		return false, fmt.Errorf("get pause config map: %w", err)
+	}
+	p.global = cm.Data[PauseKey] == "true"
+	p.checkedAt = time.Now()
+	return p.global, nil
+}
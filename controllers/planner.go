@@ -0,0 +1,354 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+)
+
+// AdminAPI is MinIO admin API used by reconcilers.
+type AdminAPI interface {
+	GetUserInfo(ctx context.Context, name string) (madmin.UserInfo, error)
+	AddUser(ctx context.Context, accessKey, secretKey string) error
+	SetUser(ctx context.Context, accessKey, secretKey string, status madmin.AccountStatus) error
+	SetUserStatus(ctx context.Context, accessKey string, status madmin.AccountStatus) error
+	RemoveUser(ctx context.Context, accessKey string) error
+
+	InfoCannedPolicy(ctx context.Context, policyName string) ([]byte, error)
+	AddCannedPolicy(ctx context.Context, policyName string, policy []byte) error
+	RemoveCannedPolicy(ctx context.Context, policyName string) error
+	SetPolicy(ctx context.Context, policyName, entityName string, isGroup bool) error
+
+	GetGroupDescription(ctx context.Context, group string) (*madmin.GroupDesc, error)
+	UpdateGroupMembers(ctx context.Context, g madmin.GroupAddRemove) error
+	SetGroupStatus(ctx context.Context, group string, status madmin.GroupStatus) error
+
+	InfoServiceAccount(ctx context.Context, accessKey string) (madmin.InfoServiceAccountResp, error)
+	AddServiceAccount(ctx context.Context, opts madmin.AddServiceAccountReq) (madmin.Credentials, error)
+	UpdateServiceAccount(ctx context.Context, accessKey string, opts madmin.UpdateServiceAccountReq) error
+	DeleteServiceAccount(ctx context.Context, serviceAccount string) error
+}
+
+// S3API is MinIO S3 API used by reconcilers.
+type S3API interface {
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
+	RemoveBucketWithOptions(ctx context.Context, bucketName string, opts minio.RemoveBucketOptions) error
+	GetBucketPolicy(ctx context.Context, bucketName string) (string, error)
+	SetBucketPolicy(ctx context.Context, bucketName, policy string) error
+}
+
+// Plan collects changes in MinIO which would be made by reconcile in dry-run mode. Planned objects are visible to
+// reads within the same reconcile, so the rest of reconcile is planned as if changes were made.
+type Plan struct {
+	lock       sync.Mutex
+	operations []string
+	buckets    map[string]string // bucket -> policy
+	users      map[string]madmin.AccountStatus
+	policies   map[string][]byte
+	groups     map[string]*madmin.GroupDesc
+}
+
+func (p *Plan) add(format string, args ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.operations = append(p.operations, fmt.Sprintf(format, args...))
+}
+
+// Operations returns planned changes in order.
+func (p *Plan) Operations() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.operations...)
+}
+
+type planKey struct{}
+
+// withPlan returns context in which MinIO changes are recorded to the plan instead of execution.
+func withPlan(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// planFromContext returns plan or nil if changes should be executed.
+func planFromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planKey{}).(*Plan)
+	return plan
+}
+
+// PlannedAdmin executes reads and executes or (if context has plan) records changes of MinIO admin API.
+type PlannedAdmin struct {
+	*madmin.AdminClient
+}
+
+// NewPlannedAdmin wraps admin client.
+func NewPlannedAdmin(admin *madmin.AdminClient) *PlannedAdmin {
+	return &PlannedAdmin{AdminClient: admin}
+}
+
+func (a *PlannedAdmin) GetUserInfo(ctx context.Context, name string) (madmin.UserInfo, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.lock.Lock()
+		status, ok := plan.users[name]
+		plan.lock.Unlock()
+		if ok {
+			return madmin.UserInfo{Status: status}, nil
+		}
+	}
+	return a.AdminClient.GetUserInfo(ctx, name)
+}
+
+func (a *PlannedAdmin) AddUser(ctx context.Context, accessKey, secretKey string) error {
+	return a.SetUser(ctx, accessKey, secretKey, madmin.AccountEnabled)
+}
+
+func (a *PlannedAdmin) SetUser(ctx context.Context, accessKey, secretKey string, status madmin.AccountStatus) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.SetUser(ctx, accessKey, secretKey, status)
+	}
+	plan.add("set user %s credentials (%s)", accessKey, status)
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	if plan.users == nil {
+		plan.users = make(map[string]madmin.AccountStatus)
+	}
+	plan.users[accessKey] = status
+	return nil
+}
+
+func (a *PlannedAdmin) SetUserStatus(ctx context.Context, accessKey string, status madmin.AccountStatus) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.SetUserStatus(ctx, accessKey, status)
+	}
+	plan.add("set user %s status %s", accessKey, status)
+	return nil
+}
+
+func (a *PlannedAdmin) RemoveUser(ctx context.Context, accessKey string) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.RemoveUser(ctx, accessKey)
+	}
+	plan.add("remove user %s", accessKey)
+	return nil
+}
+
+func (a *PlannedAdmin) InfoCannedPolicy(ctx context.Context, policyName string) ([]byte, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.lock.Lock()
+		policy, ok := plan.policies[policyName]
+		plan.lock.Unlock()
+		if ok {
+			return policy, nil
+		}
+	}
+	return a.AdminClient.InfoCannedPolicy(ctx, policyName)
+}
+
+func (a *PlannedAdmin) AddCannedPolicy(ctx context.Context, policyName string, policy []byte) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.AddCannedPolicy(ctx, policyName, policy)
+	}
+	plan.add("write canned policy %s", policyName)
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	if plan.policies == nil {
+		plan.policies = make(map[string][]byte)
+	}
+	plan.policies[policyName] = policy
+	return nil
+}
+
+func (a *PlannedAdmin) RemoveCannedPolicy(ctx context.Context, policyName string) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.RemoveCannedPolicy(ctx, policyName)
+	}
+	plan.add("remove canned policy %s", policyName)
+	return nil
+}
+
+func (a *PlannedAdmin) SetPolicy(ctx context.Context, policyName, entityName string, isGroup bool) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.SetPolicy(ctx, policyName, entityName, isGroup)
+	}
+	if isGroup {
+		plan.add("set policies %s of group %s", policyName, entityName)
+	} else {
+		plan.add("set policies %s of user %s", policyName, entityName)
+	}
+	return nil
+}
+
+func (a *PlannedAdmin) GetGroupDescription(ctx context.Context, group string) (*madmin.GroupDesc, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.lock.Lock()
+		desc, ok := plan.groups[group]
+		plan.lock.Unlock()
+		if ok {
+			return desc, nil
+		}
+	}
+	return a.AdminClient.GetGroupDescription(ctx, group)
+}
+
+func (a *PlannedAdmin) UpdateGroupMembers(ctx context.Context, g madmin.GroupAddRemove) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.UpdateGroupMembers(ctx, g)
+	}
+	if g.IsRemove {
+		plan.add("remove members [%s] from group %s", strings.Join(g.Members, ","), g.Group)
+		return nil
+	}
+	plan.add("add members [%s] to group %s", strings.Join(g.Members, ","), g.Group)
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	if plan.groups == nil {
+		plan.groups = make(map[string]*madmin.GroupDesc)
+	}
+	if _, ok := plan.groups[g.Group]; !ok {
+		plan.groups[g.Group] = &madmin.GroupDesc{Name: g.Group, Status: string(madmin.GroupEnabled)}
+	}
+	plan.groups[g.Group].Members = append(plan.groups[g.Group].Members, g.Members...)
+	return nil
+}
+
+func (a *PlannedAdmin) SetGroupStatus(ctx context.Context, group string, status madmin.GroupStatus) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.SetGroupStatus(ctx, group, status)
+	}
+	plan.add("set group %s status %s", group, status)
+	return nil
+}
+
+func (a *PlannedAdmin) AddServiceAccount(ctx context.Context, opts madmin.AddServiceAccountReq) (madmin.Credentials, error) {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.AddServiceAccount(ctx, opts)
+	}
+	plan.add("add access key for user %s", opts.TargetUser)
+	return madmin.Credentials{AccessKey: opts.AccessKey, SecretKey: opts.SecretKey}, nil
+}
+
+func (a *PlannedAdmin) UpdateServiceAccount(ctx context.Context, accessKey string, opts madmin.UpdateServiceAccountReq) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.UpdateServiceAccount(ctx, accessKey, opts)
+	}
+	plan.add("update access key %s", accessKey)
+	return nil
+}
+
+func (a *PlannedAdmin) DeleteServiceAccount(ctx context.Context, serviceAccount string) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return a.AdminClient.DeleteServiceAccount(ctx, serviceAccount)
+	}
+	plan.add("delete access key %s", serviceAccount)
+	return nil
+}
+
+// PlannedS3 executes reads and executes or (if context has plan) records changes of MinIO S3 API.
+type PlannedS3 struct {
+	*minio.Client
+}
+
+// NewPlannedS3 wraps S3 client.
+func NewPlannedS3(client *minio.Client) *PlannedS3 {
+	return &PlannedS3{Client: client}
+}
+
+func (s *PlannedS3) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.lock.Lock()
+		_, ok := plan.buckets[bucketName]
+		plan.lock.Unlock()
+		if ok {
+			return true, nil
+		}
+	}
+	return s.Client.BucketExists(ctx, bucketName)
+}
+
+func (s *PlannedS3) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return s.Client.MakeBucket(ctx, bucketName, opts)
+	}
+	plan.add("create bucket %s", bucketName)
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	if plan.buckets == nil {
+		plan.buckets = make(map[string]string)
+	}
+	plan.buckets[bucketName] = ""
+	return nil
+}
+
+func (s *PlannedS3) RemoveBucketWithOptions(ctx context.Context, bucketName string, opts minio.RemoveBucketOptions) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return s.Client.RemoveBucketWithOptions(ctx, bucketName, opts)
+	}
+	if opts.ForceDelete {
+		plan.add("remove bucket %s with all objects", bucketName)
+	} else {
+		plan.add("remove bucket %s", bucketName)
+	}
+	return nil
+}
+
+func (s *PlannedS3) GetBucketPolicy(ctx context.Context, bucketName string) (string, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.lock.Lock()
+		policy, ok := plan.buckets[bucketName]
+		plan.lock.Unlock()
+		if ok {
+			return policy, nil
+		}
+	}
+	return s.Client.GetBucketPolicy(ctx, bucketName)
+}
+
+func (s *PlannedS3) SetBucketPolicy(ctx context.Context, bucketName, policy string) error {
+	plan := planFromContext(ctx)
+	if plan == nil {
+		return s.Client.SetBucketPolicy(ctx, bucketName, policy)
+	}
+	if policy == "" {
+		plan.add("remove policy of bucket %s", bucketName)
+	} else {
+		plan.add("write policy of bucket %s", bucketName)
+	}
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	if _, ok := plan.buckets[bucketName]; ok {
+		plan.buckets[bucketName] = policy
+	}
+	return nil
+}
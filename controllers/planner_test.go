@@ -0,0 +1,149 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+)
+
+// Planned clients wrap nil MinIO clients: in plan mode changes and reads of planned objects should not reach MinIO.
+func TestPlan(t *testing.T) {
+	admin := NewPlannedAdmin(nil)
+	s3 := NewPlannedS3(nil)
+	cases := []struct {
+		name     string
+		run      func(ctx context.Context, t *testing.T)
+		expected []string
+	}{
+		{
+			name: "bucket",
+			run: func(ctx context.Context, t *testing.T) {
+				must(t, s3.MakeBucket(ctx, "data", minio.MakeBucketOptions{}))
+				exists, err := s3.BucketExists(ctx, "data")
+				must(t, err)
+				if !exists {
+					t.Error("planned bucket should exist")
+				}
+				must(t, s3.SetBucketPolicy(ctx, "data", `{"Version":"2012-10-17"}`))
+				policy, err := s3.GetBucketPolicy(ctx, "data")
+				must(t, err)
+				if policy != `{"Version":"2012-10-17"}` {
+					t.Errorf("planned policy should be visible, got %q", policy)
+				}
+				must(t, s3.RemoveBucketWithOptions(ctx, "data", minio.RemoveBucketOptions{ForceDelete: true}))
+			},
+			expected: []string{
+				"create bucket data",
+				"write policy of bucket data",
+				"remove bucket data with all objects",
+			},
+		},
+		{
+			name: "user",
+			run: func(ctx context.Context, t *testing.T) {
+				must(t, admin.AddUser(ctx, "app", "secret"))
+				info, err := admin.GetUserInfo(ctx, "app")
+				must(t, err)
+				if info.Status != madmin.AccountEnabled {
+					t.Errorf("planned user should be enabled, got %q", info.Status)
+				}
+				must(t, admin.SetUserStatus(ctx, "app", madmin.AccountDisabled))
+				must(t, admin.SetPolicy(ctx, "a,b", "app", false))
+				must(t, admin.RemoveUser(ctx, "app"))
+			},
+			expected: []string{
+				"set user app credentials (enabled)",
+				"set user app status disabled",
+				"set policies a,b of user app",
+				"remove user app",
+			},
+		},
+		{
+			name: "policy and group",
+			run: func(ctx context.Context, t *testing.T) {
+				must(t, admin.AddCannedPolicy(ctx, "reader", []byte("{}")))
+				policy, err := admin.InfoCannedPolicy(ctx, "reader")
+				must(t, err)
+				if string(policy) != "{}" {
+					t.Errorf("planned policy should be visible, got %q", policy)
+				}
+				must(t, admin.UpdateGroupMembers(ctx, madmin.GroupAddRemove{Group: "team", Members: []string{"app"}}))
+				desc, err := admin.GetGroupDescription(ctx, "team")
+				must(t, err)
+				if !reflect.DeepEqual(desc.Members, []string{"app"}) {
+					t.Errorf("planned members should be visible, got %v", desc.Members)
+				}
+				must(t, admin.SetPolicy(ctx, "reader", "team", true))
+				must(t, admin.RemoveCannedPolicy(ctx, "reader"))
+			},
+			expected: []string{
+				"write canned policy reader",
+				"add members [app] to group team",
+				"set policies reader of group team",
+				"remove canned policy reader",
+			},
+		},
+		{
+			name: "access key",
+			run: func(ctx context.Context, t *testing.T) {
+				creds, err := admin.AddServiceAccount(ctx, madmin.AddServiceAccountReq{TargetUser: "app", AccessKey: "key", SecretKey: "secret"})
+				must(t, err)
+				if creds.AccessKey != "key" || creds.SecretKey != "secret" {
+					t.Errorf("requested credentials should be returned, got %+v", creds)
+				}
+				must(t, admin.UpdateServiceAccount(ctx, "key", madmin.UpdateServiceAccountReq{NewSecretKey: "secret2"}))
+				must(t, admin.DeleteServiceAccount(ctx, "key"))
+			},
+			expected: []string{
+				"add access key for user app",
+				"update access key key",
+				"delete access key key",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := &Plan{}
+			tc.run(withPlan(context.Background(), plan), t)
+			if operations := plan.Operations(); !reflect.DeepEqual(operations, tc.expected) {
+				t.Errorf("expected operations %q, got %q", tc.expected, operations)
+			}
+		})
+	}
+}
+
+func TestPlanFromContext(t *testing.T) {
+	if plan := planFromContext(context.Background()); plan != nil {
+		t.Error("plan should not be set in live mode")
+	}
+	plan := &Plan{}
+	if planFromContext(withPlan(context.Background(), plan)) != plan {
+		t.Error("plan should be returned from context")
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
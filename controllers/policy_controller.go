@@ -19,18 +19,28 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/minio/madmin-go"
 	"github.com/minio/minio-go/v7/pkg/policy"
 	"github.com/minio/minio-go/v7/pkg/set"
+	v1 "k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
 )
@@ -39,14 +49,36 @@ import (
 type PolicyReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
-	Admin  *madmin.AdminClient
+	Admin  AdminAPI
+	// Template for canned policy names. If not set - DefaultPolicyNameTemplate will be used.
+	PolicyName *NameTemplate
+	// Recorder for events about MinIO changes.
+	Recorder record.EventRecorder
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Timings of periodic reconciliation.
+	Resync Resync
+	// Global pause. Annotation pause works without it.
+	Pause *Pause
+	// Global dry-run. Annotation dry-run works without it.
+	DryRun *DryRun
+	// Namespaces to reconcile. Nil scope allows all namespaces.
+	Scope *Scope
+	// Events from MinIO audit webhook. Optional.
+	Events <-chan event.GenericEvent
 }
 
 const policyFinalizer = "reddec.net.k8s.minio-policy-finalizer"
 
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=policies,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=policies/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=policies/finalizers,verbs=update
+const (
+	policyUserRefField   = ".spec.userRef.name"
+	policyBucketRefField = ".spec.bucketRef.name"
+	policyGroupRefField  = ".spec.groupRef.name"
+)
+
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=policies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=policies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=policies/finalizers,verbs=update
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -62,15 +94,33 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, fmt.Errorf("get manifest: %w", err)
 	}
 
+	allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, r.Authorizer.CheckAdopt(ctx, manifest.Namespace, adoptedName(manifest)))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// pause stops all changes in MinIO, including removal
+	paused, err := r.Pause.hold(ctx, manifest, &manifest.Status.Conditions)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
 	// removal
 	if manifest.GetDeletionTimestamp() != nil {
-		logger.Info("removing policy")
-		if err := r.Admin.RemoveCannedPolicy(ctx, manifest.Name); err != nil {
-			if merr, ok := err.(madmin.ErrorResponse); ok && merr.Code == "XMinioErrAdminNoSuchPolicy" {
-				logger.Info("policy already removed")
-			} else {
-				return ctrl.Result{}, fmt.Errorf("remove bucket: %w", err)
-			}
+		logger.Info("removing policy", "policy", manifest.Status.Name)
+		if !allowed {
+			logger.Info("not authorized, MinIO state is kept")
+		} else if err := r.removePolicy(ctx, manifest); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "DeletionBlocked", fmt.Errorf("remove policy: %w", err))
+		} else if manifest.Status.Name != "" {
+			r.Recorder.Event(manifest, v1.EventTypeNormal, "PolicyRemoved", "policy "+manifest.Status.Name+" removed from MinIO")
 		}
 		controllerutil.RemoveFinalizer(manifest, policyFinalizer)
 		if err := r.Update(ctx, manifest); err != nil {
@@ -79,6 +129,26 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, nil
 	}
 
+	if !allowed {
+		logger.Info("not authorized by namespace rules")
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+	}
+
+	// assign name once (before finalizer which marks policies of previous version)
+	if manifest.Status.Name == "" {
+		name, err := r.resolvePolicyName(manifest)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("policy name: %w", err)
+		}
+		manifest.Status.Name = name
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+	}
+
 	// add finalizer
 	if !controllerutil.ContainsFinalizer(manifest, policyFinalizer) {
 		controllerutil.AddFinalizer(manifest, policyFinalizer)
@@ -87,30 +157,364 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
-	logger.Info("creating policy")
-	if err := r.Admin.AddCannedPolicy(ctx, manifest.Name, mustIAMPolicy(manifest)); err != nil {
-		return ctrl.Result{}, fmt.Errorf("add policy: %w", err)
+	target, pending, err := r.resolveTarget(ctx, manifest)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("resolve target: %w", err)
+	}
+	if pending != "" {
+		// policy will be re-queued by watch on dependencies
+		logger.Info("dependencies not ready", "reason", pending)
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:    miniov1alpha1.PolicyConditionAssigned,
+			Status:  metav1.ConditionFalse,
+			Reason:  pending,
+			Message: "waiting for dependencies",
+		})
+		if err := r.Status().Update(ctx, manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if target.bucket != "" {
+		allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, r.Authorizer.CheckBucket(ctx, manifest.Namespace, target.bucket, false))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !allowed {
+			logger.Info("bucket not authorized by namespace rules", "bucket", target.bucket)
+			if err := r.Status().Update(ctx, manifest); err != nil {
+				return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+			}
+			return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+		}
 	}
 
-	logger.Info("assigning policy")
-	if err := r.Admin.SetPolicy(ctx, manifest.Name, manifest.Spec.User, false); err != nil {
+	var drift []string
+	diff, err := r.syncCannedPolicy(ctx, manifest, mustIAMPolicy(manifest, target.entity, target.bucket))
+	if err != nil {
+		return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("add policy: %w", err))
+	}
+	if diff != "" && appliedCurrent(manifest.Status.Conditions, miniov1alpha1.PolicyConditionCreated, manifest.Generation) {
+		drift = append(drift, diff)
+	}
+	if !meta.IsStatusConditionTrue(manifest.Status.Conditions, miniov1alpha1.PolicyConditionCreated) {
+		r.Recorder.Event(manifest, v1.EventTypeNormal, "PolicyCreated", "policy "+manifest.Status.Name+" created in MinIO")
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:               miniov1alpha1.PolicyConditionCreated,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Created",
+		ObservedGeneration: manifest.Generation,
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	if target.group != nil {
+		err = setGroupPolicies(ctx, r.Client, r.Admin, target.group, manifest.Status.Name)
+	} else {
+		diff, err = r.syncUserPolicy(ctx, manifest, target.entity)
+		if diff != "" && appliedCurrent(manifest.Status.Conditions, miniov1alpha1.PolicyConditionAssigned, manifest.Generation) {
+			drift = append(drift, diff)
+		}
+	}
+	if err != nil {
 		if merr, ok := err.(madmin.ErrorResponse); ok && merr.Code == "XMinioAdminNoSuchUser" {
 			logger.Info("no such user, retrying later")
-			return ctrl.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
+			r.Recorder.Event(manifest, v1.EventTypeWarning, "UserMissing", "user "+target.entity+" does not exist in MinIO")
+			return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.retry()}, nil
+		}
+		return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("set policy: %w", err))
+	}
+	if !meta.IsStatusConditionTrue(manifest.Status.Conditions, miniov1alpha1.PolicyConditionAssigned) {
+		r.Recorder.Event(manifest, v1.EventTypeNormal, "PolicyApplied", "policy "+manifest.Status.Name+" attached to "+target.entity)
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:               miniov1alpha1.PolicyConditionAssigned,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Assigned",
+		ObservedGeneration: manifest.Generation,
+	})
+	reportDrift(r.Recorder, manifest, &manifest.Status.Conditions, drift)
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+	return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(manifest)}, nil
+}
+
+// syncCannedPolicy creates or updates canned policy only if it differs from MinIO. Returns summary of differences.
+func (r *PolicyReconciler) syncCannedPolicy(ctx context.Context, manifest *miniov1alpha1.Policy, document []byte) (string, error) {
+	current, err := r.Admin.InfoCannedPolicy(ctx, manifest.Status.Name)
+	if err != nil && !isNoSuchPolicy(err) {
+		return "", fmt.Errorf("get policy: %w", err)
+	}
+	diff, err := policyDiff(document, current, false)
+	if err != nil || diff == "" {
+		return "", err
+	}
+	log.FromContext(ctx).Info("updating policy", "policy", manifest.Status.Name, "diff", diff)
+	if err := r.Admin.AddCannedPolicy(ctx, manifest.Status.Name, document); err != nil {
+		return "", err
+	}
+	return diff, nil
+}
+
+// syncUserPolicy attaches policy to user only if it is not attached yet. MinIO replaces whole set of user policies on
+// each call, so the set is computed from MinIO and all created Policy resources targeting the user.
+// Returns summary of differences.
+func (r *PolicyReconciler) syncUserPolicy(ctx context.Context, manifest *miniov1alpha1.Policy, user string) (string, error) {
+	info, err := r.Admin.GetUserInfo(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	current := splitPolicies(info.PolicyName)
+	var names = make(map[string]bool)
+	for _, name := range current {
+		names[name] = true
+	}
+	var missing []string
+	attached, err := r.userPolicies(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range append(attached, manifest.Status.Name) {
+		if !names[name] {
+			names[name] = true
+			missing = append(missing, name)
 		}
-		return ctrl.Result{}, fmt.Errorf("set policy: %w", err)
 	}
-	return ctrl.Result{Requeue: true, RequeueAfter: time.Minute}, nil
+	if len(missing) == 0 {
+		return "", nil
+	}
+	var policies = make([]string, 0, len(names))
+	for name := range names {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+	log.FromContext(ctx).Info("assigning policies", "policies", policies, "user", user)
+	if err := r.Admin.SetPolicy(ctx, strings.Join(policies, ","), user, false); err != nil {
+		return "", err
+	}
+	if !contains(current, manifest.Status.Name) {
+		return "policy is not attached to user " + user, nil
+	}
+	return "", nil
+}
+
+// userPolicies returns MinIO names of created Policy resources (in all namespaces) attached to the user.
+func (r *PolicyReconciler) userPolicies(ctx context.Context, user string) ([]string, error) {
+	var list miniov1alpha1.PolicyList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("list policies: %w", err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		if item.GetDeletionTimestamp() != nil || !item.IsCreated() || item.Spec.GroupRef != nil {
+			continue
+		}
+		entity := item.Spec.User
+		if ref := item.Spec.UserRef; ref != nil {
+			var target miniov1alpha1.User
+			err := r.Get(ctx, client.ObjectKey{Namespace: item.Namespace, Name: ref.Name}, &target)
+			if errors2.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("get user: %w", err)
+			}
+			entity = target.AccessKey()
+		}
+		if entity == user {
+			names = append(names, item.Status.Name)
+		}
+	}
+	return names, nil
+}
+
+type policyTarget struct {
+	entity string               // user access key or group name
+	group  *miniov1alpha1.Group // set if policy should be attached to group
+	bucket string
+}
+
+// resolveTarget returns MinIO user (or group) and bucket names for policy. If referenced resources are not ready yet,
+// pending contains reason.
+func (r *PolicyReconciler) resolveTarget(ctx context.Context, manifest *miniov1alpha1.Policy) (target policyTarget, pending string, err error) {
+	target.entity, target.bucket = manifest.Spec.User, manifest.Spec.Bucket
+
+	if ref := manifest.Spec.GroupRef; ref != nil {
+		var group miniov1alpha1.Group
+		err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: ref.Name}, &group)
+		if errors2.IsNotFound(err) {
+			return target, "GroupNotFound", nil
+		}
+		if err != nil {
+			return target, "", fmt.Errorf("get group: %w", err)
+		}
+		if !group.IsReady() {
+			return target, "GroupNotReady", nil
+		}
+		target.entity = group.Status.Name
+		target.group = &group
+	} else if ref := manifest.Spec.UserRef; ref != nil {
+		var user miniov1alpha1.User
+		err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: ref.Name}, &user)
+		if errors2.IsNotFound(err) {
+			return target, "UserNotFound", nil
+		}
+		if err != nil {
+			return target, "", fmt.Errorf("get user: %w", err)
+		}
+		if !user.IsReady() {
+			return target, "UserNotReady", nil
+		}
+		target.entity = user.AccessKey()
+	}
+
+	if ref := manifest.Spec.BucketRef; ref != nil {
+		var bucket miniov1alpha1.Bucket
+		err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: ref.Name}, &bucket)
+		if errors2.IsNotFound(err) {
+			return target, "BucketNotFound", nil
+		}
+		if err != nil {
+			return target, "", fmt.Errorf("get bucket: %w", err)
+		}
+		if !bucket.IsReady() {
+			return target, "BucketNotReady", nil
+		}
+		target.bucket = bucket.BucketName()
+	}
+
+	if target.entity == "" {
+		return target, "", errors.New("user, userRef or groupRef should be set")
+	}
+	if target.bucket == "" {
+		return target, "", errors.New("bucket or bucketRef should be set")
+	}
+	return target, "", nil
+}
+
+func (r *PolicyReconciler) removePolicy(ctx context.Context, manifest *miniov1alpha1.Policy) error {
+	if manifest.Status.Name == "" {
+		// policy was never created
+		return nil
+	}
+	err := r.Admin.RemoveCannedPolicy(ctx, manifest.Status.Name)
+	if err == nil {
+		return nil
+	}
+	if isNoSuchPolicy(err) {
+		return nil
+	}
+	return err
+}
+
+func isNoSuchPolicy(err error) bool {
+	merr, ok := err.(madmin.ErrorResponse)
+	return ok && (merr.Code == "XMinioErrAdminNoSuchPolicy" || merr.Code == "XMinioAdminNoSuchPolicy")
+}
+
+// splitPolicies splits comma-separated list of policies as returned by MinIO.
+func splitPolicies(value string) []string {
+	var out []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// resolvePolicyName returns canned policy name in MinIO.
+func (r *PolicyReconciler) resolvePolicyName(manifest *miniov1alpha1.Policy) (string, error) {
+	if manifest.Annotations[miniov1alpha1.AdoptAnnotation] == "" && controllerutil.ContainsFinalizer(manifest, policyFinalizer) {
+		// policy created by previous version of operator where name was always used
+		return manifest.Name, nil
+	}
+	return resolveName(manifest, r.policyNameTemplate())
+}
+
+func (r *PolicyReconciler) policyNameTemplate() *NameTemplate {
+	if r.PolicyName != nil {
+		return r.PolicyName
+	}
+	return defaultPolicyName
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	ctx := context.Background()
+	err := mgr.GetFieldIndexer().IndexField(ctx, &miniov1alpha1.Policy{}, policyUserRefField, func(object client.Object) []string {
+		if ref := object.(*miniov1alpha1.Policy).Spec.UserRef; ref != nil {
+			return []string{ref.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index user ref: %w", err)
+	}
+	err = mgr.GetFieldIndexer().IndexField(ctx, &miniov1alpha1.Policy{}, policyBucketRefField, func(object client.Object) []string {
+		if ref := object.(*miniov1alpha1.Policy).Spec.BucketRef; ref != nil {
+			return []string{ref.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index bucket ref: %w", err)
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(ctx, &miniov1alpha1.Policy{}, policyGroupRefField, func(object client.Object) []string {
+		if ref := object.(*miniov1alpha1.Policy).Spec.GroupRef; ref != nil {
+			return []string{ref.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index group ref: %w", err)
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&miniov1alpha1.Policy{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &miniov1alpha1.User{}}, handler.EnqueueRequestsFromMapFunc(r.policiesByField(policyUserRefField))).
+		Watches(&source.Kind{Type: &miniov1alpha1.Bucket{}}, handler.EnqueueRequestsFromMapFunc(r.policiesByField(policyBucketRefField))).
+		Watches(&source.Kind{Type: &miniov1alpha1.Group{}}, handler.EnqueueRequestsFromMapFunc(r.policiesByField(policyGroupRefField)))
+	if r.Events != nil {
+		builder = builder.Watches(&source.Channel{Source: r.Events}, &handler.EnqueueRequestForObject{})
+	}
+	builder = r.Scope.watch(builder, r.Client, func() client.ObjectList {
+		return &miniov1alpha1.PolicyList{}
+	})
+	sandboxed := *r
+	sandboxed.Client = sandbox(r.Client)
+	sandboxed.Recorder = discardRecorder{}
+	return completeWithBackoff(builder, r.Scope.wrap(r.DryRun.wrap(r.Client, r, &sandboxed, func() client.Object {
+		return &miniov1alpha1.Policy{}
+	}, func(obj client.Object) (*[]metav1.Condition, *[]string) {
+		status := &obj.(*miniov1alpha1.Policy).Status
+		return &status.Conditions, &status.Plan
+	})))
+}
+
+// policiesByField finds policies in the same namespace which are referencing object by indexed field.
+func (r *PolicyReconciler) policiesByField(field string) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		var list miniov1alpha1.PolicyList
+		err := r.List(context.Background(), &list, client.InNamespace(object.GetNamespace()), client.MatchingFields{field: object.GetName()})
+		if err != nil {
+			log.Log.Error(err, "failed to list policies", "field", field, "object", object.GetName())
+			return nil
+		}
+		var requests = make([]reconcile.Request, 0, len(list.Items))
+		for _, item := range list.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+		return requests
+	}
 }
 
-func mustIAMPolicy(manifest *miniov1alpha1.Policy) []byte {
+func mustIAMPolicy(manifest *miniov1alpha1.Policy, principal, bucket string) []byte {
 	var p = policy.BucketAccessPolicy{
 		Version:    "2012-10-17",
 		Statements: []policy.Statement{},
@@ -128,9 +532,9 @@ func mustIAMPolicy(manifest *miniov1alpha1.Policy) []byte {
 		Actions: perms,
 		Effect:  "Allow",
 		Principal: policy.User{
-			AWS: set.CreateStringSet(manifest.Spec.User),
+			AWS: set.CreateStringSet(principal),
 		},
-		Resources: set.CreateStringSet("arn:aws:s3:::" + manifest.Spec.Bucket + "/*"),
+		Resources: set.CreateStringSet("arn:aws:s3:::" + bucket + "/*"),
 	})
 
 	data, err := json.Marshal(p)
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/validate-minio-k8s-reddec-net-v1alpha1-policy,mutating=false,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=policies,verbs=create;update,versions=v1alpha1,name=vpolicy.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// PolicyValidator validates Policy resources on admission.
+type PolicyValidator struct {
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (v *PolicyValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.Policy{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *PolicyValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(ctx, obj.(*miniov1alpha1.Policy))
+}
+
+func (v *PolicyValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldManifest, manifest := oldObj.(*miniov1alpha1.Policy), newObj.(*miniov1alpha1.Policy)
+	// canned policy name is assigned once, so adopted policy can not be switched to another one
+	oldName, name := oldManifest.Annotations[miniov1alpha1.AdoptAnnotation], manifest.Annotations[miniov1alpha1.AdoptAnnotation]
+	if oldManifest.Status.Name != "" && oldName != name {
+		path := field.NewPath("metadata", "annotations").Key(miniov1alpha1.AdoptAnnotation)
+		return invalid("Policy", manifest.Name, field.ErrorList{field.Forbidden(path, "can not be changed after creation, current policy is "+oldManifest.Status.Name)})
+	}
+	return v.validate(ctx, manifest)
+}
+
+func (v *PolicyValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *PolicyValidator) validate(ctx context.Context, manifest *miniov1alpha1.Policy) error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if !manifest.Spec.Read && !manifest.Spec.Write {
+		errs = append(errs, field.Required(spec.Child("read"), "at least one of read or write should be set"))
+	}
+	if manifest.Spec.User == "" && manifest.Spec.UserRef == nil && manifest.Spec.GroupRef == nil {
+		errs = append(errs, field.Required(spec.Child("user"), "one of user, userRef or groupRef should be set"))
+	}
+	if manifest.Spec.UserRef != nil && manifest.Spec.GroupRef != nil {
+		errs = append(errs, field.Forbidden(spec.Child("groupRef"), "userRef and groupRef can not be set together"))
+	}
+	errs = append(errs, validateAdopt(manifest)...)
+
+	var check error
+	switch {
+	case manifest.Spec.BucketRef != nil:
+		check = v.Authorizer.CheckConnection(ctx, manifest.Namespace)
+	case manifest.Spec.Bucket != "":
+		errs = append(errs, validateBucketName(spec.Child("bucket"), manifest.Spec.Bucket)...)
+		check = v.Authorizer.CheckBucket(ctx, manifest.Namespace, manifest.Spec.Bucket, false)
+	default:
+		errs = append(errs, field.Required(spec.Child("bucket"), "one of bucket or bucketRef should be set"))
+		check = v.Authorizer.CheckConnection(ctx, manifest.Namespace)
+	}
+	if check == nil {
+		check = v.Authorizer.CheckAdopt(ctx, manifest.Namespace, adoptedName(manifest))
+	}
+	denied, err := authorizationError(check)
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		errs = append(errs, denied)
+	}
+	return invalid("Policy", manifest.Name, errs)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// Default timings of reconciliation.
+const (
+	DefaultResyncPeriod = time.Minute
+	DefaultRetryPeriod  = 10 * time.Second
+)
+
+// minResyncPeriod protects MinIO from too frequent checks set by annotation.
+const minResyncPeriod = time.Second
+
+// Resync defines timings of periodic reconciliation.
+type Resync struct {
+	// Period of checking resources in MinIO. Can be overridden by ResyncAnnotation. Default is DefaultResyncPeriod.
+	Period time.Duration
+	// Delay before retry if dependency in MinIO is not ready yet (ex: user of policy). Default is DefaultRetryPeriod.
+	RetryPeriod time.Duration
+}
+
+// after returns resync period of the resource. Invalid annotation is ignored.
+func (rs Resync) after(obj client.Object) time.Duration {
+	if value := obj.GetAnnotations()[miniov1alpha1.ResyncAnnotation]; value != "" {
+		if period, err := time.ParseDuration(value); err == nil {
+			if period < minResyncPeriod {
+				return minResyncPeriod
+			}
+			return period
+		}
+	}
+	if rs.Period > 0 {
+		return rs.Period
+	}
+	return DefaultResyncPeriod
+}
+
+func (rs Resync) retry() time.Duration {
+	if rs.RetryPeriod > 0 {
+		return rs.RetryPeriod
+	}
+	return DefaultRetryPeriod
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultScopeInterval is interval of checking namespaces matched by selector.
+const DefaultScopeInterval = 30 * time.Second
+
+// Scope limits reconciliation to static namespaces and namespaces matched by label selector. Matched namespaces are
+// checked periodically and changes are applied without restart: manager watches all namespaces and events from
+// other namespaces are filtered out. Resources of added namespaces are enqueued. Nil scope allows all namespaces.
+type Scope struct {
+	Static   []string
+	Selector labels.Selector
+	// Uncached reader for namespaces.
+	Reader   client.Reader
+	Interval time.Duration
+
+	lock       sync.RWMutex
+	namespaces map[string]bool
+	listeners  []func(added []string)
+}
+
+// Start refreshes namespaces till context is done. Implements manager.Runnable.
+func (s *Scope) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if err := s.Refresh(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "unable to resolve namespaces")
+		}
+	}
+}
+
+// NeedLeaderElection returns false: namespaces are refreshed by all replicas, so followers are ready to take over.
+func (s *Scope) NeedLeaderElection() bool {
+	return false
+}
+
+// Refresh resolves namespaces and enqueues resources of added namespaces.
+func (s *Scope) Refresh(ctx context.Context) error {
+	var set = make(map[string]bool)
+	for _, ns := range s.Static {
+		set[ns] = true
+	}
+	if s.Selector != nil {
+		var list v1.NamespaceList
+		if err := s.Reader.List(ctx, &list, client.MatchingLabelsSelector{Selector: s.Selector}); err != nil {
+			return fmt.Errorf("list namespaces: %w", err)
+		}
+		for _, ns := range list.Items {
+			if ns.DeletionTimestamp == nil {
+				set[ns.Name] = true
+			}
+		}
+	}
+
+	s.lock.Lock()
+	var added []string
+	for ns := range set {
+		if !s.namespaces[ns] {
+			added = append(added, ns)
+		}
+	}
+	changed := len(added) > 0 || len(set) != len(s.namespaces)
+	s.namespaces = set
+	listeners := s.listeners
+	s.lock.Unlock()
+
+	if changed {
+		log.FromContext(ctx).Info("watched namespaces changed", "namespaces", s.Namespaces())
+	}
+	sort.Strings(added)
+	for _, listener := range listeners {
+		listener(added)
+	}
+	return nil
+}
+
+// Namespaces returns sorted list of namespaces in scope.
+func (s *Scope) Namespaces() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var out = make([]string, 0, len(s.namespaces))
+	for ns := range s.namespaces {
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Contains returns true if namespace is in scope.
+func (s *Scope) Contains(namespace string) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.namespaces[namespace]
+}
+
+// watch filters events by namespace and enqueues resources (listed by reader) of namespaces added to scope.
+func (s *Scope) watch(b *builder.Builder, reader client.Reader, newList func() client.ObjectList) *builder.Builder {
+	if s == nil {
+		return b
+	}
+	added := source.Func(func(ctx context.Context, h handler.EventHandler, queue workqueue.RateLimitingInterface, _ ...predicate.Predicate) error {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.listeners = append(s.listeners, func(namespaces []string) {
+			for _, ns := range namespaces {
+				list := newList()
+				if err := reader.List(ctx, list, client.InNamespace(ns)); err != nil {
+					log.FromContext(ctx).Error(err, "failed to list resources of added namespace", "namespace", ns)
+					continue
+				}
+				_ = meta.EachListItem(list, func(item runtime.Object) error {
+					if obj, ok := item.(client.Object); ok {
+						h.Generic(event.GenericEvent{Object: obj}, queue)
+					}
+					return nil
+				})
+			}
+		})
+		return nil
+	})
+	return b.
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return s.Contains(obj.GetNamespace())
+		})).
+		Watches(added, &handler.EnqueueRequestForObject{})
+}
+
+// wrap skips requests of namespaces removed from scope (ex: requeued before removal).
+func (s *Scope) wrap(r reconcile.Reconciler) reconcile.Reconciler {
+	if s == nil {
+		return r
+	}
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		if !s.Contains(req.Namespace) {
+			return reconcile.Result{}, nil
+		}
+		return r.Reconcile(ctx, req)
+	})
+}
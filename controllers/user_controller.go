@@ -31,26 +31,63 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const userFinalizer = "reddec.net.k8s.minio-user-finalizer"
 const secretSize = 32
 
+const userCredentialsFromField = ".spec.credentialsFrom.name"
+
+// userAccessKeyField indexes users by access key assigned in status.
+const userAccessKeyField = ".status.accessKey"
+
+// Keys in credentials secret
+const (
+	secretAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	secretSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+)
+
 // UserReconciler reconciles a User object
 type UserReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Admin  *madmin.AdminClient
+	Scheme     *runtime.Scheme
+	Admin      AdminAPI
+	Recorder   record.EventRecorder
+	Connection Connection // used in secret templates
+	// Template for user names (access keys). If not set - DefaultUserNameTemplate will be used.
+	UserName *NameTemplate
+	// Uncached reader for secrets copies in other namespaces.
+	APIReader client.Reader
+	// Namespaces where secret copies are allowed (AnyNamespace for all).
+	SecretNamespaces []string
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Timings of periodic reconciliation.
+	Resync Resync
+	// Global pause. Annotation pause works without it.
+	Pause *Pause
+	// Global dry-run. Annotation dry-run works without it.
+	DryRun *DryRun
+	// Namespaces to reconcile. Nil scope allows all namespaces.
+	Scope *Scope
+	// Events from MinIO audit webhook. Optional.
+	Events <-chan event.GenericEvent
 }
 
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=users,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=users/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=minio.k8s.reddec.net,namespace=minio,resources=users/finalizers,verbs=update
-//+kubebuilder:rbac:groups="",resources=secrets,namespace=minio,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=users,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=users/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=minio.k8s.reddec.net,resources=users/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,11 +104,42 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, fmt.Errorf("get manifest: %w", err)
 	}
 
+	allowed, err := r.Authorizer.authorize(&manifest.Status.Conditions, r.Authorizer.CheckConnection(ctx, manifest.Namespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// pause stops all changes in MinIO, including removal
+	paused, err := r.Pause.hold(ctx, &manifest, &manifest.Status.Conditions)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(&manifest)}, nil
+	}
+
 	// removal
 	if manifest.GetDeletionTimestamp() != nil {
 		logger.Info("removing user")
-		if err := r.removeUser(ctx, &manifest); err != nil {
-			return ctrl.Result{}, fmt.Errorf("remove user: %w", err)
+		owner, err := r.accessKeyOwner(ctx, &manifest, manifest.AccessKey())
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !allowed {
+			logger.Info("not authorized, MinIO state is kept")
+		} else if owner != nil {
+			logger.Info("access key belongs to another user, MinIO state is kept", "owner", client.ObjectKeyFromObject(owner))
+		} else if err := r.removeUser(ctx, &manifest); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, &manifest, "DeletionBlocked", fmt.Errorf("remove user: %w", err))
+		} else {
+			r.Recorder.Event(&manifest, v1.EventTypeNormal, "UserRemoved", "user "+manifest.AccessKey()+" removed from MinIO")
+		}
+		if err := r.removeCopies(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("remove secret copies: %w", err)
 		}
 		controllerutil.RemoveFinalizer(&manifest, userFinalizer)
 		if err := r.Update(ctx, &manifest); err != nil {
@@ -80,6 +148,52 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, nil
 	}
 
+	// assign access key once
+	accessKey := manifest.Status.AccessKey
+	if accessKey == "" {
+		accessKey, err = resolveAccessKey(&manifest, r.UserName)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("access key: %w", err)
+		}
+	}
+	// users in different namespaces may resolve to the same access key, MinIO user is managed only by its owner
+	owner, err := r.accessKeyOwner(ctx, &manifest, accessKey)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != nil {
+		message := fmt.Sprintf("access key %s is used by user %s", accessKey, client.ObjectKeyFromObject(owner))
+		logger.Info("access key conflict", "accessKey", accessKey, "owner", client.ObjectKeyFromObject(owner))
+		r.Recorder.Event(&manifest, v1.EventTypeWarning, "AccessKeyConflict", message)
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:    miniov1alpha1.UserConditionCreated,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AccessKeyConflict",
+			Message: message,
+		})
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(&manifest)}, nil
+	}
+	if manifest.Status.AccessKey == "" {
+		manifest.Status.AccessKey = accessKey
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+	} else if manifest.Spec.AccessKey != "" && manifest.Spec.AccessKey != manifest.Status.AccessKey {
+		logger.Info("access key can not be changed", "current", manifest.Status.AccessKey, "requested", manifest.Spec.AccessKey)
+		r.Recorder.Event(&manifest, v1.EventTypeWarning, "AccessKeyImmutable", "access key can not be changed after creation, current is "+manifest.Status.AccessKey)
+	}
+
+	if !allowed {
+		logger.Info("not authorized by namespace rules")
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: r.Resync.after(&manifest)}, nil
+	}
+
 	// add finalizer
 	if !controllerutil.ContainsFinalizer(&manifest, userFinalizer) {
 		controllerutil.AddFinalizer(&manifest, userFinalizer)
@@ -88,94 +202,395 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		}
 	}
 
+	if manifest.GraceMode() {
+		return r.reconcileGrace(ctx, &manifest)
+	}
+
+	// keys may left after grace mode
+	if err := r.revokeIssuedKeys(ctx, &manifest, true); err != nil {
+		return ctrl.Result{}, fmt.Errorf("revoke issued keys: %w", err)
+	}
+
 	// create or update secret
 	logger.Info("creating secret")
-	secret, err := r.createOrUpdateSecret(ctx, &manifest)
+	secret, pending, err := r.createOrUpdateSecret(ctx, &manifest)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("set secret: %w", err)
 	}
+	if pending != "" {
+		// will be re-queued by watch on secrets
+		logger.Info("external credentials not ready", "reason", pending)
+		meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+			Type:    miniov1alpha1.UserConditionSecretCreated,
+			Status:  metav1.ConditionFalse,
+			Reason:  pending,
+			Message: "waiting for secret " + manifest.Spec.CredentialsFrom.Name,
+		})
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
 	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
 		Type:   miniov1alpha1.UserConditionSecretCreated,
-		Status: "true",
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
 	})
-	if err := r.Update(ctx, &manifest); err != nil {
+	if err := r.Status().Update(ctx, &manifest); err != nil {
 		return ctrl.Result{}, fmt.Errorf("update status (2): %w", err)
 	}
 
-	// create user
-	logger.Info("creating user")
-	if err := r.Admin.AddUser(ctx, manifest.Name, secret); err != nil {
-		return ctrl.Result{}, fmt.Errorf("create user: %w", err)
+	// create or update user
+	status, reason := accountStatus(&manifest, time.Now())
+	if err := r.syncUser(ctx, &manifest, secret, status); err != nil {
+		return ctrl.Result{}, recordError(r.Recorder, &manifest, "MinIOError", fmt.Errorf("create user: %w", err))
+	}
+	if !meta.IsStatusConditionTrue(manifest.Status.Conditions, miniov1alpha1.UserConditionCreated) {
+		r.Recorder.Event(&manifest, v1.EventTypeNormal, "UserCreated", "user "+manifest.AccessKey()+" created in MinIO")
 	}
 	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
 		Type:   miniov1alpha1.UserConditionCreated,
-		Status: "true",
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
 	})
-	if err := r.Update(ctx, &manifest); err != nil {
+	setEnabledCondition(&manifest, status, reason)
+	if err := r.Status().Update(ctx, &manifest); err != nil {
 		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
 	}
 
-	// update user
-	if err := r.Admin.SetUser(ctx, manifest.Name, secret, madmin.AccountEnabled); err != nil {
-		return ctrl.Result{}, fmt.Errorf("update user: %w", err)
+	if message := ignoredRotation(&manifest); message != "" {
+		r.Recorder.Event(&manifest, v1.EventTypeWarning, "RotationIgnored", message)
+		if request := manifest.Annotations[miniov1alpha1.RotateAnnotation]; request != manifest.Status.RotationRequest {
+			// acknowledge request, so it is reported once
+			manifest.Status.RotationRequest = request
+			if err := r.Status().Update(ctx, &manifest); err != nil {
+				return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+			}
+		}
+	}
+
+	// rotate credentials
+	rotation, err := rotationReason(&manifest, time.Now())
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("check rotation: %w", err)
+	}
+	if rotation != "" {
+		logger.Info("rotating credentials", "reason", rotation)
+		if err := r.rotatePassword(ctx, &manifest, rotation); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, &manifest, "RotationFailed", fmt.Errorf("rotate credentials: %w", err))
+		}
+	} else if manifest.Status.LastRotated == nil {
+		// creation is the first rotation
+		now := metav1.Now()
+		manifest.Status.LastRotated = &now
+		if err := r.Status().Update(ctx, &manifest); err != nil {
+			return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+		}
 	}
 
-	return ctrl.Result{RequeueAfter: time.Minute, Requeue: true}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter(&manifest, r.Resync.after(&manifest), time.Now()), Requeue: true}, nil
+}
+
+// resolveAccessKey returns user name in MinIO from spec or operator template.
+func resolveAccessKey(manifest *miniov1alpha1.User, tpl *NameTemplate) (string, error) {
+	if manifest.Spec.AccessKey != "" {
+		return manifest.Spec.AccessKey, validateAccessKey(manifest.Spec.AccessKey)
+	}
+	if controllerutil.ContainsFinalizer(manifest, userFinalizer) {
+		// user created by previous version of operator where name was always used
+		return manifest.Name, nil
+	}
+	if tpl == nil {
+		tpl = defaultUserName
+	}
+	accessKey, err := tpl.Render(manifest)
+	if err != nil {
+		return "", err
+	}
+	return accessKey, validateAccessKey(accessKey)
+}
+
+// syncUser creates or updates user in MinIO only if MinIO state or credentials differ from desired. Out-of-band
+// changes are reported as drift. Status is not saved.
+func (r *UserReconciler) syncUser(ctx context.Context, manifest *miniov1alpha1.User, secret string, status madmin.AccountStatus) error {
+	fingerprint := credentialsFingerprint(manifest, manifest.AccessKey(), secret)
+	info, err := r.Admin.GetUserInfo(ctx, manifest.AccessKey())
+	exists := err == nil
+	if err != nil && !isNoSuchUser(err) {
+		return fmt.Errorf("get user: %w", err)
+	}
+
+	var drift []string
+	if !exists && manifest.IsReady() {
+		drift = append(drift, "user is missing")
+	}
+	if exists && info.Status != status && statusApplied(manifest, status) {
+		drift = append(drift, fmt.Sprintf("user is %s, expected %s", info.Status, status))
+	}
+	if exists && info.Status == status && manifest.Status.CredentialsFingerprint == fingerprint {
+		reportDrift(r.Recorder, manifest, &manifest.Status.Conditions, nil)
+		return nil
+	}
+
+	log.FromContext(ctx).Info("updating user", "exists", exists)
+	if err := r.Admin.SetUser(ctx, manifest.AccessKey(), secret, status); err != nil {
+		return err
+	}
+	manifest.Status.CredentialsFingerprint = fingerprint
+	reportDrift(r.Recorder, manifest, &manifest.Status.Conditions, drift)
+	return nil
+}
+
+// statusApplied checks that desired account status was already applied to MinIO, so difference is out-of-band change.
+func statusApplied(manifest *miniov1alpha1.User, status madmin.AccountStatus) bool {
+	condition := meta.FindStatusCondition(manifest.Status.Conditions, miniov1alpha1.UserConditionEnabled)
+	if condition == nil {
+		return false
+	}
+	return (condition.Status == metav1.ConditionTrue) == (status == madmin.AccountEnabled)
 }
 
 func (r *UserReconciler) removeUser(ctx context.Context, manifest *miniov1alpha1.User) error {
-	err := r.Admin.RemoveUser(ctx, manifest.Name)
+	err := r.Admin.RemoveUser(ctx, manifest.AccessKey())
 	if err == nil {
 		return nil
 	}
-	if v, ok := err.(madmin.ErrorResponse); ok && v.Code == "XMinioAdminNoSuchUser" {
+	if isNoSuchUser(err) {
 		return nil
 	}
 	return fmt.Errorf("remove user: %w", err)
 }
 
-func (r *UserReconciler) createOrUpdateSecret(ctx context.Context, manifest *miniov1alpha1.User) (string, error) {
+// createOrUpdateSecret returns user secret key. If credentials are provided externally and not ready, pending contains
+// reason.
+func (r *UserReconciler) createOrUpdateSecret(ctx context.Context, manifest *miniov1alpha1.User) (pass string, pending string, err error) {
+	if manifest.Spec.CredentialsFrom != nil {
+		return r.externalCredentials(ctx, manifest)
+	}
 	var secret = &v1.Secret{}
-	err := r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: manifest.SecretName()}, secret)
+	err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: manifest.SecretName()}, secret)
 	if err == nil {
-		_, hasName := secret.Data["AWS_ACCESS_KEY_ID"]
-		if pass, hasSecret := secret.Data["AWS_SECRET_ACCESS_KEY"]; hasSecret && hasName && len(pass) == 2*secretSize {
-			return string(pass), nil
+		name := string(secret.Data[secretAccessKeyID])
+		if pass, hasSecret := secret.Data[secretSecretAccessKey]; hasSecret && name == manifest.AccessKey() && len(pass) == 2*secretSize {
+			// templates could be changed
+			return string(pass), "", r.writeSecret(ctx, manifest, manifest.AccessKey(), string(pass))
 		}
-		pass := mustGetSecret(secretSize)
-		secret.Data = map[string][]byte{
-			"AWS_ACCESS_KEY_ID":     []byte(manifest.Name),
-			"AWS_SECRET_ACCESS_KEY": []byte(pass),
+	} else if !errors2.IsNotFound(err) {
+		return "", "", err
+	}
+	pass = mustGetSecret(secretSize)
+	return pass, "", r.writeSecret(ctx, manifest, manifest.AccessKey(), pass)
+}
+
+// externalCredentials reads secret key from referenced secret and copies credentials to user secret (if it is not
+// the same secret).
+func (r *UserReconciler) externalCredentials(ctx context.Context, manifest *miniov1alpha1.User) (pass string, pending string, err error) {
+	source := manifest.Spec.CredentialsFrom
+	var secret v1.Secret
+	err = r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: source.Name}, &secret)
+	if errors2.IsNotFound(err) {
+		return "", "CredentialsNotFound", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("get credentials secret: %w", err)
+	}
+	var secretKeyKey = source.SecretKeyKey
+	if secretKeyKey == "" {
+		secretKeyKey = secretSecretAccessKey
+	}
+	pass = string(secret.Data[secretKeyKey])
+	if pass == "" {
+		return "", "CredentialsInvalid", nil
+	}
+	if source.AccessKeyKey != "" && string(secret.Data[source.AccessKeyKey]) != manifest.AccessKey() {
+		return "", "AccessKeyMismatch", nil
+	}
+	if source.Name == manifest.SecretName() {
+		// secret is not rendered by operator, so copies contain it as is
+		if err := r.distributeSecret(ctx, manifest, secret.Data); err != nil {
+			return "", "", fmt.Errorf("distribute secret: %w", err)
 		}
-		return pass, r.Update(ctx, secret)
+		return pass, "", nil
 	}
-	if !errors2.IsNotFound(err) {
-		return "", err
+	return pass, "", r.writeSecret(ctx, manifest, manifest.AccessKey(), pass)
+}
+
+// writeSecret creates or updates credentials secret owned by user.
+func (r *UserReconciler) writeSecret(ctx context.Context, manifest *miniov1alpha1.User, accessKey, secretKey string) error {
+	buckets, err := r.attachedBuckets(ctx, manifest)
+	if err != nil {
+		return fmt.Errorf("get buckets: %w", err)
+	}
+	data, err := renderSecret(manifest, secretData{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Endpoint:  r.Connection.Endpoint,
+		URL:       r.Connection.URL(),
+		Host:      r.Connection.Host(),
+		Region:    r.Connection.Region,
+		Secure:    r.Connection.Secure,
+		Buckets:   buckets,
+	})
+	if err != nil {
+		return fmt.Errorf("render secret: %w", err)
 	}
-	pass := mustGetSecret(secretSize)
-	secret = &v1.Secret{
+	var secret = &v1.Secret{
 		ObjectMeta: ctrl.ObjectMeta{
 			Name:      manifest.SecretName(),
 			Namespace: manifest.Namespace,
 		},
-		Data: map[string][]byte{
-			"AWS_ACCESS_KEY_ID":     []byte(manifest.Name),
-			"AWS_SECRET_ACCESS_KEY": []byte(pass),
-		},
 	}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Data = data
+		if err := ctrl.SetControllerReference(manifest, secret, r.Scheme); err != nil {
+			return fmt.Errorf("set controller refrence: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.distributeSecret(ctx, manifest, data); err != nil {
+		return fmt.Errorf("distribute secret: %w", err)
+	}
+	return nil
+}
+
+// accessKeyOwner returns another user which owns the access key. Nil means that the key is free or owned by
+// the manifest.
+func (r *UserReconciler) accessKeyOwner(ctx context.Context, manifest *miniov1alpha1.User, accessKey string) (*miniov1alpha1.User, error) {
+	var list miniov1alpha1.UserList
+	if err := r.List(ctx, &list, client.MatchingFields{userAccessKeyField: accessKey}); err != nil {
+		return nil, fmt.Errorf("list users by access key: %w", err)
+	}
+	return accessKeyOwner(manifest, accessKey, list.Items), nil
+}
+
+// accessKeyOwner finds owner of the access key among users: the earliest created user with the key assigned in
+// status. Users created by previous versions of operator may share the key, so only one of them manages it.
+func accessKeyOwner(manifest *miniov1alpha1.User, accessKey string, users []miniov1alpha1.User) *miniov1alpha1.User {
+	var owner *miniov1alpha1.User
+	if manifest.Status.AccessKey == accessKey {
+		owner = manifest
+	}
+	for i := range users {
+		user := &users[i]
+		if user.Status.AccessKey != accessKey || user.UID == manifest.UID {
+			continue
+		}
+		if owner == nil || createdBefore(user, owner) {
+			owner = user
+		}
+	}
+	if owner == manifest {
+		return nil
+	}
+	return owner
+}
 
-	if err := ctrl.SetControllerReference(manifest, secret, r.Scheme); err != nil {
-		return "", fmt.Errorf("set controller refrence: %w", err)
+func createdBefore(a, b client.Object) bool {
+	ta, tb := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !ta.Equal(&tb) {
+		return ta.Before(&tb)
 	}
-	return pass, r.Create(ctx, secret)
+	return client.ObjectKeyFromObject(a).String() < client.ObjectKeyFromObject(b).String()
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *UserReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &miniov1alpha1.User{}, userAccessKeyField, func(object client.Object) []string {
+		if accessKey := object.(*miniov1alpha1.User).Status.AccessKey; accessKey != "" {
+			return []string{accessKey}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index access key: %w", err)
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &miniov1alpha1.User{}, userCredentialsFromField, func(object client.Object) []string {
+		if source := object.(*miniov1alpha1.User).Spec.CredentialsFrom; source != nil {
+			return []string{source.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("index credentials source: %w", err)
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&miniov1alpha1.User{}).
 		Owns(&v1.Secret{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &v1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.usersOfCredentials)).
+		Watches(&source.Kind{Type: &miniov1alpha1.Policy{}}, handler.EnqueueRequestsFromMapFunc(r.userOfPolicy))
+	if r.Events != nil {
+		builder = builder.Watches(&source.Channel{Source: r.Events}, &handler.EnqueueRequestForObject{})
+	}
+	builder = r.Scope.watch(builder, r.Client, func() client.ObjectList {
+		return &miniov1alpha1.UserList{}
+	})
+	sandboxed := *r
+	sandboxed.Client = sandbox(r.Client)
+	sandboxed.Recorder = discardRecorder{}
+	return completeWithBackoff(builder, r.Scope.wrap(r.DryRun.wrap(r.Client, r, &sandboxed, func() client.Object {
+		return &miniov1alpha1.User{}
+	}, func(obj client.Object) (*[]metav1.Condition, *[]string) {
+		status := &obj.(*miniov1alpha1.User).Status
+		return &status.Conditions, &status.Plan
+	})))
+}
+
+// usersOfCredentials finds users which are using secret as source of credentials.
+func (r *UserReconciler) usersOfCredentials(object client.Object) []reconcile.Request {
+	var list miniov1alpha1.UserList
+	err := r.List(context.Background(), &list, client.InNamespace(object.GetNamespace()), client.MatchingFields{userCredentialsFromField: object.GetName()})
+	if err != nil {
+		log.Log.Error(err, "failed to list users", "secret", object.GetName())
+		return nil
+	}
+	var requests = make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
+}
+
+// userOfPolicy enqueues user referenced by policy, since list of buckets in secret may change.
+func (r *UserReconciler) userOfPolicy(object client.Object) []reconcile.Request {
+	ref := object.(*miniov1alpha1.Policy).Spec.UserRef
+	if ref == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: object.GetNamespace(), Name: ref.Name}}}
+}
+
+// accountStatus returns desired status of user account and reason of it.
+func accountStatus(manifest *miniov1alpha1.User, now time.Time) (madmin.AccountStatus, string) {
+	if manifest.Spec.Disabled {
+		return madmin.AccountDisabled, "Disabled"
+	}
+	if until := manifest.Spec.SuspendUntil; until != nil && now.Before(until.Time) {
+		return madmin.AccountDisabled, "Suspended"
+	}
+	return madmin.AccountEnabled, "Enabled"
+}
+
+func setEnabledCondition(manifest *miniov1alpha1.User, status madmin.AccountStatus, reason string) {
+	var condition = metav1.Condition{
+		Type:   miniov1alpha1.UserConditionEnabled,
+		Status: metav1.ConditionTrue,
+		Reason: reason,
+	}
+	if status != madmin.AccountEnabled {
+		condition.Status = metav1.ConditionFalse
+		if until := manifest.Spec.SuspendUntil; until != nil && reason == "Suspended" {
+			condition.Message = "suspended until " + until.Format(time.RFC3339)
+		}
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, condition)
+}
+
+func isNoSuchUser(err error) bool {
+	merr, ok := err.(madmin.ErrorResponse)
+	return ok && merr.Code == "XMinioAdminNoSuchUser"
 }
 
 func mustGetSecret(bytes int) string {
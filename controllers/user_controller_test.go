@@ -0,0 +1,64 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func TestAccessKeyOwner(t *testing.T) {
+	early := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	late := metav1.NewTime(early.Add(time.Hour))
+	user := func(namespace, accessKey string, created metav1.Time) miniov1alpha1.User {
+		return miniov1alpha1.User{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app", UID: types.UID(namespace), CreationTimestamp: created},
+			Status:     miniov1alpha1.UserStatus{AccessKey: accessKey},
+		}
+	}
+	cases := []struct {
+		name     string
+		manifest miniov1alpha1.User
+		users    []miniov1alpha1.User
+		owner    string
+	}{
+		{name: "free", manifest: user("team-a", "", late)},
+		{name: "self", manifest: user("team-a", "app", late), users: []miniov1alpha1.User{user("team-a", "app", late)}},
+		{name: "claimed by other", manifest: user("team-a", "", early), users: []miniov1alpha1.User{user("team-b", "app", late)}, owner: "team-b"},
+		{name: "shared, manifest is older", manifest: user("team-a", "app", early), users: []miniov1alpha1.User{user("team-b", "app", late)}},
+		{name: "shared, other is older", manifest: user("team-a", "app", late), users: []miniov1alpha1.User{user("team-b", "app", early)}, owner: "team-b"},
+		{name: "shared, same time", manifest: user("team-b", "app", early), users: []miniov1alpha1.User{user("team-a", "app", early)}, owner: "team-a"},
+		{name: "other key", manifest: user("team-a", "", late), users: []miniov1alpha1.User{user("team-b", "other", early)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			owner := accessKeyOwner(&tc.manifest, "app", tc.users)
+			var namespace string
+			if owner != nil {
+				namespace = owner.Namespace
+			}
+			if namespace != tc.owner {
+				t.Errorf("expected owner %q, got %q", tc.owner, namespace)
+			}
+		})
+	}
+}
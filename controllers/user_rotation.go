@@ -0,0 +1,304 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/robfig/cron/v3"
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// nextRotation returns time of the next credentials rotation. Zero time means rotation is not scheduled.
+func nextRotation(manifest *miniov1alpha1.User) (time.Time, error) {
+	rotation := manifest.Spec.Rotation
+	if rotation == nil || manifest.Status.LastRotated == nil {
+		return time.Time{}, nil
+	}
+	last := manifest.Status.LastRotated.Time
+	if rotation.Interval != nil {
+		if rotation.Interval.Duration <= 0 {
+			return time.Time{}, errors.New("rotation interval should be positive")
+		}
+		return last.Add(rotation.Interval.Duration), nil
+	}
+	if rotation.Schedule != "" {
+		schedule, err := cron.ParseStandard(rotation.Schedule)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse rotation schedule: %w", err)
+		}
+		return schedule.Next(last), nil
+	}
+	return time.Time{}, nil
+}
+
+// rotationReason returns reason of rotation if credentials should be rotated now. Empty reason means that rotation
+// is not needed.
+func rotationReason(manifest *miniov1alpha1.User, now time.Time) (string, error) {
+	if manifest.Spec.CredentialsFrom != nil {
+		// external credentials are rotated by owner
+		return "", nil
+	}
+	if value := manifest.Annotations[miniov1alpha1.RotateAnnotation]; value != "" && value != manifest.Status.RotationRequest {
+		return "Requested", nil
+	}
+	next, err := nextRotation(manifest)
+	if err != nil {
+		return "", err
+	}
+	if !next.IsZero() && !now.Before(next) {
+		return "Scheduled", nil
+	}
+	return "", nil
+}
+
+// ignoredRotation returns explanation if rotation is set or requested for external credentials, which are rotated
+// by owner of the secret.
+func ignoredRotation(manifest *miniov1alpha1.User) string {
+	source := manifest.Spec.CredentialsFrom
+	if source == nil {
+		return ""
+	}
+	if manifest.Spec.Rotation != nil {
+		return "rotation does not apply to external credentials, update secret " + source.Name + " instead"
+	}
+	if value := manifest.Annotations[miniov1alpha1.RotateAnnotation]; value != "" && value != manifest.Status.RotationRequest {
+		return "rotation request ignored: credentials are provided by secret " + source.Name
+	}
+	return ""
+}
+
+// rotated marks rotation as done and emits event.
+func (r *UserReconciler) rotated(manifest *miniov1alpha1.User, reason string) {
+	now := metav1.Now()
+	manifest.Status.LastRotated = &now
+	manifest.Status.RotationRequest = manifest.Annotations[miniov1alpha1.RotateAnnotation]
+	r.Recorder.Event(manifest, v1.EventTypeNormal, "CredentialsRotated", reason+" rotation of credentials done")
+}
+
+// requeueAfter returns time till next scheduled action (rotation, revocation or resume) limited by resync period.
+func requeueAfter(manifest *miniov1alpha1.User, period time.Duration, now time.Time) time.Duration {
+	var after = period
+	if next, err := nextRotation(manifest); err == nil && !next.IsZero() {
+		if left := next.Sub(now); left < after {
+			after = left
+		}
+	}
+	if until := manifest.Spec.SuspendUntil; until != nil && now.Before(until.Time) {
+		if left := until.Sub(now); left < after {
+			after = left
+		}
+	}
+	for _, key := range manifest.Status.IssuedKeys {
+		if key.RevokeAt != nil {
+			if left := key.RevokeAt.Sub(now); left < after {
+				after = left
+			}
+		}
+	}
+	if after < time.Second {
+		after = time.Second
+	}
+	return after
+}
+
+// rotatePassword generates new secret for user, updates MinIO and then secret.
+func (r *UserReconciler) rotatePassword(ctx context.Context, manifest *miniov1alpha1.User, reason string) error {
+	pass := mustGetSecret(secretSize)
+	status, _ := accountStatus(manifest, time.Now())
+	if err := r.Admin.SetUser(ctx, manifest.AccessKey(), pass, status); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	manifest.Status.CredentialsFingerprint = credentialsFingerprint(manifest, manifest.AccessKey(), pass)
+	if err := r.writeSecret(ctx, manifest, manifest.AccessKey(), pass); err != nil {
+		return fmt.Errorf("update secret: %w", err)
+	}
+	r.rotated(manifest, reason)
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+	return nil
+}
+
+// reconcileGrace reconciles user in rotation grace mode: secret contains credentials of the user access key (service
+// account). On rotation, new access key issued and previous one is revoked after grace period.
+func (r *UserReconciler) reconcileGrace(ctx context.Context, manifest *miniov1alpha1.User) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// user password is not published in grace mode, so it is set only once
+	var drift []string
+	info, err := r.Admin.GetUserInfo(ctx, manifest.AccessKey())
+	if err != nil {
+		if !isNoSuchUser(err) {
+			return ctrl.Result{}, fmt.Errorf("get user: %w", err)
+		}
+		if manifest.IsReady() {
+			drift = append(drift, "user is missing")
+		}
+		logger.Info("creating user")
+		if err := r.Admin.AddUser(ctx, manifest.AccessKey(), mustGetSecret(secretSize)); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("create user: %w", err))
+		}
+		info.Status = madmin.AccountEnabled
+		r.Recorder.Event(manifest, v1.EventTypeNormal, "UserCreated", "user "+manifest.AccessKey()+" created in MinIO")
+	}
+	status, reason := accountStatus(manifest, time.Now())
+	if info.Status != status {
+		if len(drift) == 0 && statusApplied(manifest, status) {
+			drift = append(drift, fmt.Sprintf("user is %s, expected %s", info.Status, status))
+		}
+		if err := r.Admin.SetUserStatus(ctx, manifest.AccessKey(), status); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "MinIOError", fmt.Errorf("update user status: %w", err))
+		}
+	}
+	reportDrift(r.Recorder, manifest, &manifest.Status.Conditions, drift)
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.UserConditionCreated,
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
+	})
+	setEnabledCondition(manifest, status, reason)
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	rotation, err := rotationReason(manifest, time.Now())
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("check rotation: %w", err)
+	}
+	valid, err := r.hasCurrentKey(ctx, manifest)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("check secret: %w", err)
+	}
+
+	if rotation != "" || !valid {
+		logger.Info("issuing new access key", "rotation", rotation)
+		if err := r.issueKey(ctx, manifest); err != nil {
+			return ctrl.Result{}, recordError(r.Recorder, manifest, "RotationFailed", fmt.Errorf("issue access key: %w", err))
+		}
+		if rotation != "" {
+			// previous password is not used by anyone, but should be rotated as well
+			if err := r.Admin.SetUser(ctx, manifest.AccessKey(), mustGetSecret(secretSize), status); err != nil {
+				return ctrl.Result{}, fmt.Errorf("update user: %w", err)
+			}
+			r.rotated(manifest, rotation)
+		} else {
+			now := metav1.Now()
+			manifest.Status.LastRotated = &now
+		}
+	}
+	meta.SetStatusCondition(&manifest.Status.Conditions, metav1.Condition{
+		Type:   miniov1alpha1.UserConditionSecretCreated,
+		Status: metav1.ConditionTrue,
+		Reason: "Created",
+	})
+	if err := r.Status().Update(ctx, manifest); err != nil {
+		return ctrl.Result{}, fmt.Errorf("update status: %w", err)
+	}
+
+	if err := r.revokeIssuedKeys(ctx, manifest, false); err != nil {
+		return ctrl.Result{}, fmt.Errorf("revoke issued keys: %w", err)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter(manifest, r.Resync.after(manifest), time.Now()), Requeue: true}, nil
+}
+
+// hasCurrentKey checks that secret contains current issued key.
+func (r *UserReconciler) hasCurrentKey(ctx context.Context, manifest *miniov1alpha1.User) (bool, error) {
+	current := currentIssuedKey(manifest)
+	if current == "" {
+		return false, nil
+	}
+	var secret v1.Secret
+	err := r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: manifest.SecretName()}, &secret)
+	if errors2.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(secret.Data[secretAccessKeyID]) == current && len(secret.Data[secretSecretAccessKey]) > 0, nil
+}
+
+// issueKey creates new access key for user, saves it to secret and schedules revocation of previous key.
+// Status is not saved.
+func (r *UserReconciler) issueKey(ctx context.Context, manifest *miniov1alpha1.User) error {
+	accessKey, secretKey := mustGetSecret(serviceAccountKeySize), mustGetSecret(serviceAccountSecretSize)
+	_, err := r.Admin.AddServiceAccount(ctx, madmin.AddServiceAccountReq{
+		TargetUser: manifest.AccessKey(),
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+	})
+	if err != nil {
+		return fmt.Errorf("add service account: %w", err)
+	}
+	if err := r.writeSecret(ctx, manifest, accessKey, secretKey); err != nil {
+		return fmt.Errorf("update secret: %w", err)
+	}
+	revokeAt := metav1.NewTime(time.Now().Add(manifest.Spec.Rotation.GracePeriod.Duration))
+	for i := range manifest.Status.IssuedKeys {
+		if manifest.Status.IssuedKeys[i].RevokeAt == nil {
+			manifest.Status.IssuedKeys[i].RevokeAt = &revokeAt
+		}
+	}
+	manifest.Status.IssuedKeys = append(manifest.Status.IssuedKeys, miniov1alpha1.IssuedKey{AccessKey: accessKey})
+	return nil
+}
+
+// revokeIssuedKeys revokes access keys which grace period passed. If all is true, all keys are revoked.
+func (r *UserReconciler) revokeIssuedKeys(ctx context.Context, manifest *miniov1alpha1.User, all bool) error {
+	if len(manifest.Status.IssuedKeys) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var keep []miniov1alpha1.IssuedKey
+	for _, key := range manifest.Status.IssuedKeys {
+		if !all && (key.RevokeAt == nil || now.Before(key.RevokeAt.Time)) {
+			keep = append(keep, key)
+			continue
+		}
+		if err := r.Admin.DeleteServiceAccount(ctx, key.AccessKey); err != nil && !isNoSuchServiceAccount(err) {
+			return fmt.Errorf("delete service account %s: %w", key.AccessKey, err)
+		}
+	}
+	if len(keep) == len(manifest.Status.IssuedKeys) {
+		return nil
+	}
+	manifest.Status.IssuedKeys = keep
+	return r.Status().Update(ctx, manifest)
+}
+
+func currentIssuedKey(manifest *miniov1alpha1.User) string {
+	for _, key := range manifest.Status.IssuedKeys {
+		if key.RevokeAt == nil {
+			return key.AccessKey
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func rotatedUser(rotation *miniov1alpha1.Rotation, lastRotated time.Time) *miniov1alpha1.User {
+	user := &miniov1alpha1.User{Spec: miniov1alpha1.UserSpec{Rotation: rotation}}
+	if !lastRotated.IsZero() {
+		last := metav1.NewTime(lastRotated)
+		user.Status.LastRotated = &last
+	}
+	return user
+}
+
+func TestNextRotation(t *testing.T) {
+	last := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		rotation *miniov1alpha1.Rotation
+		last     time.Time
+		expected time.Time
+		fail     bool
+	}{
+		{name: "no rotation", last: last},
+		{name: "not rotated yet", rotation: &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: time.Hour}}},
+		{name: "interval", rotation: &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: time.Hour}}, last: last, expected: last.Add(time.Hour)},
+		{name: "schedule", rotation: &miniov1alpha1.Rotation{Schedule: "0 3 * * *"}, last: last, expected: time.Date(2022, 6, 2, 3, 0, 0, 0, time.UTC)},
+		{
+			name:     "interval has priority",
+			rotation: &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: time.Minute}, Schedule: "0 3 * * *"},
+			last:     last,
+			expected: last.Add(time.Minute),
+		},
+		{name: "empty rotation", rotation: &miniov1alpha1.Rotation{}, last: last},
+		{name: "negative interval", rotation: &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: -time.Hour}}, last: last, fail: true},
+		{name: "invalid schedule", rotation: &miniov1alpha1.Rotation{Schedule: "every day"}, last: last, fail: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := nextRotation(rotatedUser(tc.rotation, tc.last))
+			if tc.fail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !next.Equal(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, next)
+			}
+		})
+	}
+}
+
+func TestRotationReason(t *testing.T) {
+	last := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	hourly := &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: time.Hour}}
+	cases := []struct {
+		name     string
+		user     *miniov1alpha1.User
+		now      time.Time
+		expected string
+	}{
+		{name: "not scheduled", user: rotatedUser(nil, last), now: last.Add(24 * time.Hour)},
+		{name: "not due", user: rotatedUser(hourly, last), now: last.Add(time.Minute)},
+		{name: "due", user: rotatedUser(hourly, last), now: last.Add(time.Hour), expected: "Scheduled"},
+		{
+			name: "requested",
+			user: func() *miniov1alpha1.User {
+				user := rotatedUser(nil, last)
+				user.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: "1"}
+				return user
+			}(),
+			now:      last,
+			expected: "Requested",
+		},
+		{
+			name: "request handled",
+			user: func() *miniov1alpha1.User {
+				user := rotatedUser(nil, last)
+				user.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: "1"}
+				user.Status.RotationRequest = "1"
+				return user
+			}(),
+			now: last,
+		},
+		{
+			name: "external credentials",
+			user: func() *miniov1alpha1.User {
+				user := rotatedUser(hourly, last)
+				user.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: "1"}
+				user.Spec.CredentialsFrom = &miniov1alpha1.CredentialsSource{Name: "external"}
+				return user
+			}(),
+			now: last.Add(time.Hour),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, err := rotationReason(tc.user, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reason != tc.expected {
+				t.Errorf("expected reason %q, got %q", tc.expected, reason)
+			}
+		})
+	}
+}
+
+func TestIgnoredRotation(t *testing.T) {
+	last := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	external := func(rotation *miniov1alpha1.Rotation, request string) *miniov1alpha1.User {
+		user := rotatedUser(rotation, last)
+		user.Spec.CredentialsFrom = &miniov1alpha1.CredentialsSource{Name: "external"}
+		user.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: request}
+		return user
+	}
+	handled := external(nil, "1")
+	handled.Status.RotationRequest = "1"
+	generated := rotatedUser(&miniov1alpha1.Rotation{Schedule: "@hourly"}, last)
+	generated.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: "1"}
+
+	cases := []struct {
+		name    string
+		user    *miniov1alpha1.User
+		ignored bool
+	}{
+		{name: "generated credentials", user: generated},
+		{name: "external credentials", user: external(nil, "")},
+		{name: "scheduled", user: external(&miniov1alpha1.Rotation{Schedule: "@hourly"}, ""), ignored: true},
+		{name: "requested", user: external(nil, "1"), ignored: true},
+		{name: "request acknowledged", user: handled},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if message := ignoredRotation(tc.user); tc.ignored != (message != "") {
+				t.Errorf("ignored %v, got message %q", tc.ignored, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// Connection describes MinIO server for clients.
+type Connection struct {
+	Endpoint string
+	Region   string
+	Secure   bool
+}
+
+// URL of MinIO server with scheme.
+func (c Connection) URL() string {
+	if strings.Contains(c.Endpoint, "://") {
+		return c.Endpoint
+	}
+	if c.Secure {
+		return "https://" + c.Endpoint
+	}
+	return "http://" + c.Endpoint
+}
+
+// Host of MinIO server without scheme.
+func (c Connection) Host() string {
+	if idx := strings.Index(c.Endpoint, "://"); idx >= 0 {
+		return c.Endpoint[idx+3:]
+	}
+	return c.Endpoint
+}
+
+// secretData is available in user secret templates.
+type secretData struct {
+	AccessKey string
+	SecretKey string
+	Endpoint  string // as configured for operator
+	URL       string // endpoint with scheme
+	Host      string // endpoint without scheme
+	Region    string
+	Secure    bool
+	Buckets   []string // buckets from policies attached to the user
+}
+
+var secretFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// renderSecret renders content of user secret. Default keys are always set since they are used by operator to
+// read credentials back.
+func renderSecret(manifest *miniov1alpha1.User, data secretData) (map[string][]byte, error) {
+	var out = map[string][]byte{
+		secretAccessKeyID:     []byte(data.AccessKey),
+		secretSecretAccessKey: []byte(data.SecretKey),
+	}
+	for key, text := range manifest.Spec.SecretTemplate {
+		if key == secretAccessKeyID || key == secretSecretAccessKey {
+			return nil, fmt.Errorf("key %s is reserved", key)
+		}
+		tpl, err := template.New(key).Funcs(secretFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse template for %s: %w", key, err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("render template for %s: %w", key, err)
+		}
+		out[key] = buf.Bytes()
+	}
+	for _, format := range manifest.Spec.SecretFormats {
+		files, err := renderFormat(format, data)
+		if err != nil {
+			return nil, fmt.Errorf("render %s config: %w", format, err)
+		}
+		for name, content := range files {
+			if _, exists := out[name]; exists {
+				return nil, fmt.Errorf("key %s of %s config is already used", name, format)
+			}
+			out[name] = content
+		}
+	}
+	return out, nil
+}
+
+// clientAlias is name of remote (alias) in client configs.
+const clientAlias = "minio"
+
+// renderFormat renders client configuration files.
+func renderFormat(format miniov1alpha1.SecretFormat, data secretData) (map[string][]byte, error) {
+	switch format {
+	case miniov1alpha1.SecretFormatAWS:
+		credentials := "[default]\n" +
+			"aws_access_key_id = " + data.AccessKey + "\n" +
+			"aws_secret_access_key = " + data.SecretKey + "\n"
+		config := "[default]\n" +
+			"region = " + data.Region + "\n" +
+			"endpoint_url = " + data.URL + "\n" +
+			"s3 =\n" +
+			"    addressing_style = path\n"
+		return map[string][]byte{
+			"credentials": []byte(credentials),
+			"config":      []byte(config),
+		}, nil
+	case miniov1alpha1.SecretFormatRclone:
+		config := "[" + clientAlias + "]\n" +
+			"type = s3\n" +
+			"provider = Minio\n" +
+			"env_auth = false\n" +
+			"access_key_id = " + data.AccessKey + "\n" +
+			"secret_access_key = " + data.SecretKey + "\n" +
+			"region = " + data.Region + "\n" +
+			"endpoint = " + data.URL + "\n"
+		return map[string][]byte{
+			"rclone.conf": []byte(config),
+		}, nil
+	case miniov1alpha1.SecretFormatMC:
+		type mcAlias struct {
+			URL       string `json:"url"`
+			AccessKey string `json:"accessKey"`
+			SecretKey string `json:"secretKey"`
+			API       string `json:"api"`
+			Path      string `json:"path"`
+		}
+		config, err := json.MarshalIndent(struct {
+			Version string             `json:"version"`
+			Aliases map[string]mcAlias `json:"aliases"`
+		}{
+			Version: "10",
+			Aliases: map[string]mcAlias{
+				clientAlias: {
+					URL:       data.URL,
+					AccessKey: data.AccessKey,
+					SecretKey: data.SecretKey,
+					API:       "S3v4",
+					Path:      "auto",
+				},
+			},
+		}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{
+			"config.json": config,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// attachedBuckets returns sorted names of buckets from policies in the same namespace which are attached to the user.
+func (r *UserReconciler) attachedBuckets(ctx context.Context, manifest *miniov1alpha1.User) ([]string, error) {
+	var list miniov1alpha1.PolicyList
+	if err := r.List(ctx, &list, client.InNamespace(manifest.Namespace)); err != nil {
+		return nil, fmt.Errorf("list policies: %w", err)
+	}
+	var names = make(map[string]bool)
+	for _, policy := range list.Items {
+		if !policyForUser(&policy, manifest) {
+			continue
+		}
+		if ref := policy.Spec.BucketRef; ref != nil {
+			var bucket miniov1alpha1.Bucket
+			if err := r.Get(ctx, client.ObjectKey{Namespace: manifest.Namespace, Name: ref.Name}, &bucket); err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return nil, fmt.Errorf("get bucket: %w", err)
+				}
+				continue
+			}
+			names[bucket.BucketName()] = true
+		} else if policy.Spec.Bucket != "" {
+			names[policy.Spec.Bucket] = true
+		}
+	}
+	var buckets = make([]string, 0, len(names))
+	for name := range names {
+		buckets = append(buckets, name)
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+func policyForUser(policy *miniov1alpha1.Policy, user *miniov1alpha1.User) bool {
+	if policy.Spec.GroupRef != nil {
+		return false
+	}
+	if ref := policy.Spec.UserRef; ref != nil {
+		return ref.Name == user.Name
+	}
+	return policy.Spec.User == user.AccessKey()
+}
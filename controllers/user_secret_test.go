@@ -0,0 +1,170 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+var testSecretData = secretData{
+	AccessKey: "app",
+	SecretKey: "secret",
+	Endpoint:  "minio:9000",
+	URL:       "http://minio:9000",
+	Host:      "minio:9000",
+	Region:    "us-east-1",
+	Buckets:   []string{"data", "logs"},
+}
+
+func TestRenderSecret(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     miniov1alpha1.UserSpec
+		expected map[string]string // subset of keys
+		fail     bool
+	}{
+		{
+			name:     "default keys",
+			expected: map[string]string{secretAccessKeyID: "app", secretSecretAccessKey: "secret"},
+		},
+		{
+			name: "templates",
+			spec: miniov1alpha1.UserSpec{SecretTemplate: map[string]string{
+				"S3_ENDPOINT": "{{.URL}}",
+				"S3_BUCKETS":  `{{join .Buckets ","}}`,
+			}},
+			expected: map[string]string{secretAccessKeyID: "app", "S3_ENDPOINT": "http://minio:9000", "S3_BUCKETS": "data,logs"},
+		},
+		{
+			name: "formats",
+			spec: miniov1alpha1.UserSpec{SecretFormats: []miniov1alpha1.SecretFormat{
+				miniov1alpha1.SecretFormatAWS, miniov1alpha1.SecretFormatRclone,
+			}},
+			expected: map[string]string{secretAccessKeyID: "app"},
+		},
+		{
+			name: "reserved key",
+			spec: miniov1alpha1.UserSpec{SecretTemplate: map[string]string{secretSecretAccessKey: "{{.SecretKey}}"}},
+			fail: true,
+		},
+		{
+			name: "invalid template",
+			spec: miniov1alpha1.UserSpec{SecretTemplate: map[string]string{"KEY": "{{.URL"}},
+			fail: true,
+		},
+		{
+			name: "unknown field",
+			spec: miniov1alpha1.UserSpec{SecretTemplate: map[string]string{"KEY": "{{.Password}}"}},
+			fail: true,
+		},
+		{
+			name: "template conflicts with format",
+			spec: miniov1alpha1.UserSpec{
+				SecretTemplate: map[string]string{"config": "custom"},
+				SecretFormats:  []miniov1alpha1.SecretFormat{miniov1alpha1.SecretFormatAWS},
+			},
+			fail: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := renderSecret(&miniov1alpha1.User{Spec: tc.spec}, testSecretData)
+			if tc.fail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tc.expected {
+				if string(out[key]) != value {
+					t.Errorf("%s: expected %q, got %q", key, value, out[key])
+				}
+			}
+			for _, format := range tc.spec.SecretFormats {
+				files, _ := renderFormat(format, testSecretData)
+				for name := range files {
+					if _, ok := out[name]; !ok {
+						t.Errorf("file %s of %s format is missing", name, format)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRenderFormat(t *testing.T) {
+	cases := []struct {
+		format   miniov1alpha1.SecretFormat
+		file     string
+		contains []string
+	}{
+		{format: miniov1alpha1.SecretFormatAWS, file: "credentials", contains: []string{"aws_access_key_id = app\n", "aws_secret_access_key = secret\n"}},
+		{format: miniov1alpha1.SecretFormatAWS, file: "config", contains: []string{"region = us-east-1\n", "endpoint_url = http://minio:9000\n"}},
+		{format: miniov1alpha1.SecretFormatRclone, file: "rclone.conf", contains: []string{"[minio]\n", "provider = Minio\n", "endpoint = http://minio:9000\n"}},
+		{format: miniov1alpha1.SecretFormatMC, file: "config.json", contains: []string{`"url": "http://minio:9000"`}},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.format)+"/"+tc.file, func(t *testing.T) {
+			files, err := renderFormat(tc.format, testSecretData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, ok := files[tc.file]
+			if !ok {
+				t.Fatalf("file %s is missing", tc.file)
+			}
+			for _, part := range tc.contains {
+				if !strings.Contains(string(content), part) {
+					t.Errorf("%q is not found in:\n%s", part, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderFormat_MC(t *testing.T) {
+	files, err := renderFormat(miniov1alpha1.SecretFormatMC, testSecretData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Aliases map[string]struct {
+			AccessKey string `json:"accessKey"`
+			SecretKey string `json:"secretKey"`
+		} `json:"aliases"`
+	}
+	if err := json.Unmarshal(files["config.json"], &config); err != nil {
+		t.Fatal(err)
+	}
+	alias := config.Aliases[clientAlias]
+	if alias.AccessKey != "app" || alias.SecretKey != "secret" {
+		t.Errorf("unexpected credentials of alias: %+v", alias)
+	}
+}
+
+func TestRenderFormat_Unknown(t *testing.T) {
+	if _, err := renderFormat("s3cmd", testSecretData); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// Labels of secret copies. Owner references can not cross namespaces, so copies are tracked by labels.
+const (
+	copyLabelNamespace = "minio.k8s.reddec.net/user-namespace"
+	copyLabelName      = "minio.k8s.reddec.net/user-name"
+)
+
+// targetAllowed checks that secret can be copied to the namespace.
+func (r *UserReconciler) targetAllowed(manifest *miniov1alpha1.User, target miniov1alpha1.SecretTarget) bool {
+	if target.Namespace == "" || target.Namespace == manifest.Namespace {
+		return target.Name != manifest.SecretName()
+	}
+	for _, ns := range r.SecretNamespaces {
+		if ns == miniov1alpha1.AnyNamespace || ns == target.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// distributeSecret writes copies of user secret to targets and removes stale copies. Targets occupied by other
+// secrets are skipped and reported. Status is not saved.
+func (r *UserReconciler) distributeSecret(ctx context.Context, manifest *miniov1alpha1.User, data map[string][]byte) error {
+	var expected = make(map[client.ObjectKey]bool, len(manifest.Spec.SecretTargets))
+	var copies, conflicts []miniov1alpha1.SecretTarget
+	for _, target := range manifest.Spec.SecretTargets {
+		if !r.targetAllowed(manifest, target) {
+			r.Recorder.Eventf(manifest, v1.EventTypeWarning, "TargetNotAllowed", "secret can not be copied to %s/%s", target.Namespace, target.Name)
+			continue
+		}
+		key := client.ObjectKey{Namespace: target.Namespace, Name: target.Name}
+		if key.Namespace == "" {
+			key.Namespace = manifest.Namespace
+		}
+		if expected[key] {
+			continue
+		}
+		expected[key] = true
+		err := r.writeCopy(ctx, manifest, key, data)
+		if errors.Is(err, errSecretNotOwned) {
+			r.Recorder.Eventf(manifest, v1.EventTypeWarning, "TargetConflict", "secret %s exists and it is not a copy of the user secret", key)
+			conflicts = append(conflicts, miniov1alpha1.SecretTarget{Namespace: key.Namespace, Name: key.Name})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("copy secret to %s: %w", key, err)
+		}
+		copies = append(copies, miniov1alpha1.SecretTarget{Namespace: key.Namespace, Name: key.Name})
+	}
+
+	existing, err := r.copiesOf(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	for _, key := range existing {
+		if expected[key] {
+			continue
+		}
+		if err := r.removeCopy(ctx, manifest, key); err != nil {
+			return fmt.Errorf("remove stale copy %s: %w", key, err)
+		}
+	}
+	manifest.Status.SecretCopies = copies
+	manifest.Status.SecretConflicts = conflicts
+	return nil
+}
+
+// removeCopies removes all copies of user secret.
+func (r *UserReconciler) removeCopies(ctx context.Context, manifest *miniov1alpha1.User) error {
+	existing, err := r.copiesOf(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	for _, key := range existing {
+		if err := r.removeCopy(ctx, manifest, key); err != nil {
+			return fmt.Errorf("remove copy %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// copiesOf finds copies of user secret by labels in namespaces where copies are allowed. Copies recorded in status
+// are included as well (namespace may be not allowed anymore).
+func (r *UserReconciler) copiesOf(ctx context.Context, manifest *miniov1alpha1.User) ([]client.ObjectKey, error) {
+	var namespaces = []string{manifest.Namespace}
+	for _, ns := range r.SecretNamespaces {
+		if ns == miniov1alpha1.AnyNamespace {
+			namespaces = []string{metav1.NamespaceAll}
+			break
+		}
+		if !contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	var keys []client.ObjectKey
+	var seen = make(map[client.ObjectKey]bool)
+	add := func(key client.ObjectKey) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, ns := range namespaces {
+		var list v1.SecretList
+		err := r.APIReader.List(ctx, &list, client.InNamespace(ns), client.MatchingLabels{
+			copyLabelNamespace: manifest.Namespace,
+			copyLabelName:      manifest.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list copies in %q: %w", ns, err)
+		}
+		for _, item := range list.Items {
+			add(client.ObjectKeyFromObject(&item))
+		}
+	}
+	for _, item := range manifest.Status.SecretCopies {
+		add(client.ObjectKey{Namespace: item.Namespace, Name: item.Name})
+	}
+	return keys, nil
+}
+
+// removeCopy removes secret copy only if it is labeled as copy of the user secret.
+func (r *UserReconciler) removeCopy(ctx context.Context, manifest *miniov1alpha1.User, key client.ObjectKey) error {
+	var secret v1.Secret
+	err := r.APIReader.Get(ctx, key, &secret)
+	if errors2.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isCopyOf(&secret, manifest) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, &secret))
+}
+
+func isCopyOf(secret *v1.Secret, manifest *miniov1alpha1.User) bool {
+	return secret.Labels[copyLabelNamespace] == manifest.Namespace && secret.Labels[copyLabelName] == manifest.Name
+}
+
+// writeCopy creates or updates secret copy. Cache may not contain other namespaces, so API reader is used.
+func (r *UserReconciler) writeCopy(ctx context.Context, manifest *miniov1alpha1.User, key client.ObjectKey, data map[string][]byte) error {
+	var labels = map[string]string{
+		copyLabelNamespace: manifest.Namespace,
+		copyLabelName:      manifest.Name,
+	}
+	var secret v1.Secret
+	err := r.APIReader.Get(ctx, key, &secret)
+	if errors2.IsNotFound(err) {
+		return r.Create(ctx, &v1.Secret{
+			ObjectMeta: ctrl.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    labels,
+			},
+			Data: data,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if !isCopyOf(&secret, manifest) {
+		return fmt.Errorf("%w: %s", errSecretNotOwned, key)
+	}
+	if reflect.DeepEqual(secret.Data, data) {
+		return nil
+	}
+	secret.Data = data
+	return r.Update(ctx, &secret)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+func TestUserReconciler_distributeSecret(t *testing.T) {
+	user := &miniov1alpha1.User{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: miniov1alpha1.UserSpec{SecretTargets: []miniov1alpha1.SecretTarget{
+			{Namespace: "web", Name: "app-minio"},
+			{Namespace: "api", Name: "app-minio"},
+			{Namespace: "jobs", Name: "app-minio"},
+			{Namespace: "other", Name: "app-minio"},
+		}},
+	}
+	foreign := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "api", Name: "app-minio"},
+		Data:       map[string][]byte{"password": []byte("foreign")},
+	}
+	stale := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "old", Labels: map[string]string{
+		copyLabelNamespace: "default",
+		copyLabelName:      "app",
+	}}}
+	c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(foreign, stale).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &UserReconciler{Client: c, APIReader: c, Recorder: recorder, SecretNamespaces: []string{"web", "api", "jobs"}}
+	data := map[string][]byte{secretAccessKeyID: []byte("app")}
+
+	must(t, r.distributeSecret(context.Background(), user, data))
+
+	expectedCopies := []miniov1alpha1.SecretTarget{{Namespace: "web", Name: "app-minio"}, {Namespace: "jobs", Name: "app-minio"}}
+	if !reflect.DeepEqual(user.Status.SecretCopies, expectedCopies) {
+		t.Errorf("copies: %+v", user.Status.SecretCopies)
+	}
+	expectedConflicts := []miniov1alpha1.SecretTarget{{Namespace: "api", Name: "app-minio"}}
+	if !reflect.DeepEqual(user.Status.SecretConflicts, expectedConflicts) {
+		t.Errorf("conflicts: %+v", user.Status.SecretConflicts)
+	}
+	for _, target := range expectedCopies {
+		var secret v1.Secret
+		must(t, c.Get(context.Background(), client.ObjectKey{Namespace: target.Namespace, Name: target.Name}, &secret))
+		if !reflect.DeepEqual(secret.Data, data) || !isCopyOf(&secret, user) {
+			t.Errorf("copy %s/%s not written", target.Namespace, target.Name)
+		}
+	}
+	var secret v1.Secret
+	must(t, c.Get(context.Background(), client.ObjectKeyFromObject(foreign), &secret))
+	if !reflect.DeepEqual(secret.Data, foreign.Data) {
+		t.Errorf("foreign secret overwritten")
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(stale), &secret); err == nil {
+		t.Errorf("stale copy not removed")
+	}
+
+	var reasons []string
+	for len(recorder.Events) > 0 {
+		reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+	}
+	if !reflect.DeepEqual(reasons, []string{"TargetConflict", "TargetNotAllowed"}) {
+		t.Errorf("events: %v", reasons)
+	}
+}
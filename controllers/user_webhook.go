@@ -0,0 +1,182 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+//+kubebuilder:webhook:path=/mutate-minio-k8s-reddec-net-v1alpha1-user,mutating=true,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=users,verbs=create;update,versions=v1alpha1,name=muser.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// UserDefaulter persists defaults of User resources on admission, so effective values are visible.
+type UserDefaulter struct {
+	// Template for user names (access keys). If not set - DefaultUserNameTemplate will be used.
+	UserName *NameTemplate
+}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (d *UserDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.User{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+func (d *UserDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	manifest := obj.(*miniov1alpha1.User)
+	if manifest.Name == "" {
+		// name is not generated yet
+		return nil
+	}
+	if manifest.Spec.SecretName == "" {
+		manifest.Spec.SecretName = manifest.SecretName()
+	}
+	if manifest.Spec.AccessKey == "" {
+		accessKey := manifest.Status.AccessKey
+		if accessKey == "" {
+			resolved, err := resolveAccessKey(manifest, d.UserName)
+			if err != nil {
+				return invalid("User", manifest.Name, field.ErrorList{field.Invalid(field.NewPath("spec", "accessKey"), manifest.Spec.AccessKey, err.Error())})
+			}
+			accessKey = resolved
+		}
+		manifest.Spec.AccessKey = accessKey
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-minio-k8s-reddec-net-v1alpha1-user,mutating=false,failurePolicy=fail,sideEffects=None,groups=minio.k8s.reddec.net,resources=users,verbs=create;update,versions=v1alpha1,name=vuser.minio.k8s.reddec.net,admissionReviewVersions=v1
+
+// UserValidator validates User resources on admission.
+type UserValidator struct {
+	// Namespace rules. If not set - all namespaces are allowed.
+	Authorizer *Authorizer
+	// Cached reader with access key index (registered by UserReconciler). If not set - conflicts of access keys
+	// are checked only by controller.
+	Reader client.Reader
+}
+
+// SetupWebhookWithManager registers the webhook in the Manager.
+func (v *UserValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&miniov1alpha1.User{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *UserValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	manifest := obj.(*miniov1alpha1.User)
+	errs := validateUserSpec(manifest)
+	errs = append(errs, validateRotationRequest(manifest, "")...)
+	return v.validate(ctx, manifest, errs)
+}
+
+func (v *UserValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldManifest, manifest := oldObj.(*miniov1alpha1.User), newObj.(*miniov1alpha1.User)
+	errs := validateUserSpec(manifest)
+	errs = append(errs, validateRotationRequest(manifest, oldManifest.Annotations[miniov1alpha1.RotateAnnotation])...)
+	// access key is persisted in spec by defaulter and in status by controller
+	current := oldManifest.Status.AccessKey
+	if current == "" {
+		current = oldManifest.Spec.AccessKey
+	}
+	if current != "" && manifest.Spec.AccessKey != "" && manifest.Spec.AccessKey != current {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "accessKey"), "access key can not be changed after creation, current is "+current))
+	}
+	return v.validate(ctx, manifest, errs)
+}
+
+func (v *UserValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validate adds result of namespace rules and access key ownership checks to errs.
+func (v *UserValidator) validate(ctx context.Context, manifest *miniov1alpha1.User, errs field.ErrorList) error {
+	if accessKey := manifest.Spec.AccessKey; v.Reader != nil && accessKey != "" && manifest.Status.AccessKey == "" {
+		var list miniov1alpha1.UserList
+		if err := v.Reader.List(ctx, &list, client.MatchingFields{userAccessKeyField: accessKey}); err != nil {
+			return fmt.Errorf("list users by access key: %w", err)
+		}
+		if owner := accessKeyOwner(manifest, accessKey, list.Items); owner != nil {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "accessKey"), "access key is used by user "+client.ObjectKeyFromObject(owner).String()))
+		}
+	}
+	denied, err := authorizationError(v.Authorizer.CheckConnection(ctx, manifest.Namespace))
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		errs = append(errs, denied)
+	}
+	return invalid("User", manifest.Name, errs)
+}
+
+func validateUserSpec(manifest *miniov1alpha1.User) field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if manifest.Spec.AccessKey != "" {
+		if err := validateAccessKey(manifest.Spec.AccessKey); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("accessKey"), manifest.Spec.AccessKey, err.Error()))
+		}
+	}
+	for key, text := range manifest.Spec.SecretTemplate {
+		path := spec.Child("secretTemplate").Key(key)
+		if key == secretAccessKeyID || key == secretSecretAccessKey {
+			errs = append(errs, field.Forbidden(path, "key is reserved"))
+			continue
+		}
+		if _, err := template.New(key).Funcs(secretFuncs).Parse(text); err != nil {
+			errs = append(errs, field.Invalid(path, text, err.Error()))
+		}
+	}
+	if rotation := manifest.Spec.Rotation; rotation != nil {
+		path := spec.Child("rotation")
+		if manifest.Spec.CredentialsFrom != nil {
+			errs = append(errs, field.Forbidden(path, "rotation does not apply to external credentials"))
+		}
+		if rotation.Interval != nil && rotation.Interval.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Child("interval"), rotation.Interval.Duration.String(), "should be positive"))
+		}
+		if rotation.Schedule != "" {
+			if _, err := cron.ParseStandard(rotation.Schedule); err != nil {
+				errs = append(errs, field.Invalid(path.Child("schedule"), rotation.Schedule, err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// validateRotationRequest forbids new rotation requests (previous is value of the annotation before update) for
+// external credentials.
+func validateRotationRequest(manifest *miniov1alpha1.User, previous string) field.ErrorList {
+	value := manifest.Annotations[miniov1alpha1.RotateAnnotation]
+	if manifest.Spec.CredentialsFrom == nil || value == "" || value == previous {
+		return nil
+	}
+	path := field.NewPath("metadata", "annotations").Key(miniov1alpha1.RotateAnnotation)
+	return field.ErrorList{field.Forbidden(path, "rotation does not apply to external credentials")}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// invalid converts validation errors to API error. Returns nil if there are no errors.
+func invalid(kind, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors2.NewInvalid(schema.GroupKind{Group: miniov1alpha1.GroupVersion.Group, Kind: kind}, name, errs)
+}
+
+// authorizationError converts result of authorization check to validation error.
+func authorizationError(check error) (*field.Error, error) {
+	if errors.Is(check, ErrNotAuthorized) {
+		return field.Forbidden(field.NewPath("metadata", "namespace"), check.Error()), nil
+	}
+	return nil, check
+}
+
+// validateAdopt checks that AdoptAnnotation does not refer to built-in canned policy.
+func validateAdopt(obj client.Object) field.ErrorList {
+	if name := adoptedName(obj); contains(builtinPolicies, name) {
+		path := field.NewPath("metadata", "annotations").Key(miniov1alpha1.AdoptAnnotation)
+		return field.ErrorList{field.Forbidden(path, "built-in policy "+name+" can not be adopted")}
+	}
+	return nil
+}
+
+// validateBucketName checks S3 bucket naming rules.
+func validateBucketName(path *field.Path, name string) field.ErrorList {
+	if err := s3utils.CheckValidBucketNameStrict(name); err != nil {
+		return field.ErrorList{field.Invalid(path, name, err.Error())}
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+)
+
+// testAuthorizer allows team-a to create buckets with prefix team-a-, attach readonly policy to groups and adopt
+// MinIO objects with prefix team-a-, and team-b only to use connection.
+func testAuthorizer() *Authorizer {
+	config := &miniov1alpha1.OperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: miniov1alpha1.OperatorConfigSpec{Rules: []miniov1alpha1.NamespaceRule{
+			{Namespaces: []string{"team-a"}, Buckets: true, BucketPrefixes: []string{"team-a-"}, Policies: []string{"readonly"}, AdoptPrefixes: []string{"team-a-"}},
+			{Namespaces: []string{"team-b"}, BucketPrefixes: []string{"shared-"}},
+		}},
+	}
+	return &Authorizer{
+		Reader:     fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(config).Build(),
+		ConfigName: "default",
+		Connection: "default",
+	}
+}
+
+// validation is create (old is nil) or update of the object.
+type validation struct {
+	name    string
+	old     runtime.Object
+	object  runtime.Object
+	invalid bool
+}
+
+type validator interface {
+	ValidateCreate(ctx context.Context, obj runtime.Object) error
+	ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error
+}
+
+func runValidations(t *testing.T, v validator, cases []validation) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			if tc.old == nil {
+				err = v.ValidateCreate(context.Background(), tc.object)
+			} else {
+				err = v.ValidateUpdate(context.Background(), tc.old, tc.object)
+			}
+			if tc.invalid != (err != nil) {
+				t.Errorf("invalid %v, got error %v", tc.invalid, err)
+			}
+		})
+	}
+}
+
+func TestBucketValidator(t *testing.T) {
+	bucket := func(namespace, name string) *miniov1alpha1.Bucket {
+		return &miniov1alpha1.Bucket{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	public := bucket("team-a", "team-a-data")
+	public.Spec.Public = true
+	runValidations(t, &BucketValidator{}, []validation{
+		{name: "valid", object: bucket("default", "data")},
+		{name: "invalid name", object: bucket("default", "Data_1"), invalid: true},
+		{name: "short name", object: bucket("default", "ab"), invalid: true},
+	})
+	runValidations(t, &BucketValidator{Authorizer: testAuthorizer()}, []validation{
+		{name: "allowed", object: bucket("team-a", "team-a-data")},
+		{name: "prefix not allowed", object: bucket("team-a", "data"), invalid: true},
+		{name: "buckets not allowed", object: bucket("team-b", "shared-data"), invalid: true},
+		{name: "namespace without rules", object: bucket("team-c", "team-c-data"), invalid: true},
+		{name: "update allowed", old: bucket("team-a", "team-a-data"), object: public},
+		{name: "update after rules changed", old: bucket("team-b", "shared-data"), object: bucket("team-b", "shared-data"), invalid: true},
+	})
+}
+
+func TestUserValidator(t *testing.T) {
+	user := func(namespace string, spec miniov1alpha1.UserSpec) *miniov1alpha1.User {
+		return &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app"}, Spec: spec}
+	}
+	created := user("default", miniov1alpha1.UserSpec{AccessKey: "app"})
+	created.Status.AccessKey = "app"
+	defaulted := user("default", miniov1alpha1.UserSpec{AccessKey: "app"})
+	negative := &miniov1alpha1.Rotation{Interval: &metav1.Duration{Duration: -1}}
+	external := &miniov1alpha1.CredentialsSource{Name: "external"}
+	requested := func(value string) *miniov1alpha1.User {
+		u := user("default", miniov1alpha1.UserSpec{CredentialsFrom: external})
+		u.Annotations = map[string]string{miniov1alpha1.RotateAnnotation: value}
+		return u
+	}
+	runValidations(t, &UserValidator{}, []validation{
+		{name: "valid", object: user("default", miniov1alpha1.UserSpec{AccessKey: "app"})},
+		{name: "generated access key", object: user("default", miniov1alpha1.UserSpec{})},
+		{name: "invalid access key", object: user("default", miniov1alpha1.UserSpec{AccessKey: "a,b"}), invalid: true},
+		{name: "reserved template key", object: user("default", miniov1alpha1.UserSpec{SecretTemplate: map[string]string{secretAccessKeyID: "x"}}), invalid: true},
+		{name: "invalid template", object: user("default", miniov1alpha1.UserSpec{SecretTemplate: map[string]string{"URL": "{{.URL"}}), invalid: true},
+		{name: "invalid schedule", object: user("default", miniov1alpha1.UserSpec{Rotation: &miniov1alpha1.Rotation{Schedule: "daily"}}), invalid: true},
+		{name: "negative interval", object: user("default", miniov1alpha1.UserSpec{Rotation: negative}), invalid: true},
+		{name: "rotation of external credentials", object: user("default", miniov1alpha1.UserSpec{CredentialsFrom: external, Rotation: &miniov1alpha1.Rotation{Schedule: "@daily"}}), invalid: true},
+		{name: "rotation request of external credentials", object: requested("1"), invalid: true},
+		{name: "handled rotation request of external credentials", old: requested("1"), object: requested("1")},
+		{name: "new rotation request of external credentials", old: requested("1"), object: requested("2"), invalid: true},
+		{name: "same access key", old: created, object: user("default", miniov1alpha1.UserSpec{AccessKey: "app", Disabled: true})},
+		{name: "access key changed", old: created, object: user("default", miniov1alpha1.UserSpec{AccessKey: "app2"}), invalid: true},
+		{name: "defaulted access key changed", old: defaulted, object: user("default", miniov1alpha1.UserSpec{AccessKey: "app2"}), invalid: true},
+	})
+	runValidations(t, &UserValidator{Authorizer: testAuthorizer()}, []validation{
+		{name: "allowed", object: user("team-b", miniov1alpha1.UserSpec{})},
+		{name: "not allowed", object: user("team-c", miniov1alpha1.UserSpec{}), invalid: true},
+		{name: "update not allowed", old: user("team-c", miniov1alpha1.UserSpec{}), object: user("team-c", miniov1alpha1.UserSpec{Disabled: true}), invalid: true},
+	})
+}
+
+// usersByAccessKey serves users by access key index, which is not supported by fake client.
+type usersByAccessKey []miniov1alpha1.User
+
+func (u usersByAccessKey) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	return errors.New("not implemented")
+}
+
+func (u usersByAccessKey) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	var options client.ListOptions
+	options.ApplyOptions(opts)
+	accessKey, _ := options.FieldSelector.RequiresExactMatch(userAccessKeyField)
+	users := list.(*miniov1alpha1.UserList)
+	for _, user := range u {
+		if user.Status.AccessKey == accessKey {
+			users.Items = append(users.Items, user)
+		}
+	}
+	return nil
+}
+
+func TestUserValidator_AccessKeyConflict(t *testing.T) {
+	user := func(namespace, accessKey string) *miniov1alpha1.User {
+		return &miniov1alpha1.User{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "app", UID: types.UID(namespace)},
+			Spec:       miniov1alpha1.UserSpec{AccessKey: accessKey},
+		}
+	}
+	existing := user("team-a", "app")
+	existing.Status.AccessKey = "app"
+	updated := existing.DeepCopy()
+	updated.Spec.Disabled = true
+	runValidations(t, &UserValidator{Reader: usersByAccessKey{*existing}}, []validation{
+		{name: "free access key", object: user("team-b", "team-b-app")},
+		{name: "access key of other namespace", object: user("team-b", "app"), invalid: true},
+		{name: "update of owner", old: existing, object: updated},
+	})
+}
+
+func TestPolicyValidator(t *testing.T) {
+	policy := func(namespace string, spec miniov1alpha1.PolicySpec) *miniov1alpha1.Policy {
+		return &miniov1alpha1.Policy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "access"}, Spec: spec}
+	}
+	ref := &corev1.LocalObjectReference{Name: "ref"}
+	adopted := func(name, status string) *miniov1alpha1.Policy {
+		p := policy("default", miniov1alpha1.PolicySpec{User: "app", Bucket: "data", Read: true})
+		p.Annotations = map[string]string{miniov1alpha1.AdoptAnnotation: name}
+		p.Status.Name = status
+		return p
+	}
+	runValidations(t, &PolicyValidator{}, []validation{
+		{name: "valid", object: policy("default", miniov1alpha1.PolicySpec{User: "app", Bucket: "data", Read: true})},
+		{name: "refs", object: policy("default", miniov1alpha1.PolicySpec{GroupRef: ref, BucketRef: ref, Write: true})},
+		{name: "no permissions", object: policy("default", miniov1alpha1.PolicySpec{User: "app", Bucket: "data"}), invalid: true},
+		{name: "no subject", object: policy("default", miniov1alpha1.PolicySpec{Bucket: "data", Read: true}), invalid: true},
+		{name: "user and group", object: policy("default", miniov1alpha1.PolicySpec{UserRef: ref, GroupRef: ref, Bucket: "data", Read: true}), invalid: true},
+		{name: "no bucket", object: policy("default", miniov1alpha1.PolicySpec{User: "app", Read: true}), invalid: true},
+		{name: "invalid bucket", object: policy("default", miniov1alpha1.PolicySpec{User: "app", Bucket: "Data", Read: true}), invalid: true},
+		{name: "adopt before creation", old: adopted("", ""), object: adopted("legacy", "")},
+		{name: "same adopted policy", old: adopted("legacy", "legacy"), object: adopted("legacy", "legacy")},
+		{name: "adopted policy changed", old: adopted("legacy", "legacy"), object: adopted("other", "legacy"), invalid: true},
+		{name: "adopt built-in policy", object: adopted("readwrite", ""), invalid: true},
+	})
+	adoptedIn := func(namespace, name string) *miniov1alpha1.Policy {
+		p := policy(namespace, miniov1alpha1.PolicySpec{User: "app", BucketRef: ref, Read: true})
+		p.Annotations = map[string]string{miniov1alpha1.AdoptAnnotation: name}
+		return p
+	}
+	runValidations(t, &PolicyValidator{Authorizer: testAuthorizer()}, []validation{
+		{name: "allowed bucket", object: policy("team-b", miniov1alpha1.PolicySpec{User: "app", Bucket: "shared-data", Read: true})},
+		{name: "not allowed bucket", object: policy("team-b", miniov1alpha1.PolicySpec{User: "app", Bucket: "team-a-data", Read: true}), invalid: true},
+		{name: "bucket ref", object: policy("team-b", miniov1alpha1.PolicySpec{User: "app", BucketRef: ref, Read: true})},
+		{name: "namespace without rules", object: policy("team-c", miniov1alpha1.PolicySpec{User: "app", BucketRef: ref, Read: true}), invalid: true},
+		{name: "adopt allowed", object: adoptedIn("team-a", "team-a-legacy")},
+		{name: "adopt of other namespace", object: adoptedIn("team-a", "team-b-writers"), invalid: true},
+		{name: "adopt not allowed", object: adoptedIn("team-b", "team-b-writers"), invalid: true},
+	})
+}
+
+func TestGroupValidator(t *testing.T) {
+	group := func(namespace string, spec miniov1alpha1.GroupSpec) *miniov1alpha1.Group {
+		return &miniov1alpha1.Group{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "readers"}, Spec: spec}
+	}
+	adoptedGroup := func(namespace, name string) *miniov1alpha1.Group {
+		g := group(namespace, miniov1alpha1.GroupSpec{})
+		g.Annotations = map[string]string{miniov1alpha1.AdoptAnnotation: name}
+		return g
+	}
+	invalidSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "role", Operator: "Unknown"}}}
+	runValidations(t, &GroupValidator{}, []validation{
+		{name: "valid", object: group("default", miniov1alpha1.GroupSpec{Members: []corev1.LocalObjectReference{{Name: "app"}}, Policies: []string{"readonly"}})},
+		{name: "empty policy", object: group("default", miniov1alpha1.GroupSpec{Policies: []string{""}}), invalid: true},
+		{name: "invalid selector", object: group("default", miniov1alpha1.GroupSpec{Selector: invalidSelector}), invalid: true},
+		{name: "adopt built-in policy", object: adoptedGroup("default", "consoleAdmin"), invalid: true},
+	})
+	runValidations(t, &GroupValidator{Authorizer: testAuthorizer()}, []validation{
+		{name: "allowed policy", object: group("team-a", miniov1alpha1.GroupSpec{Policies: []string{"readonly"}})},
+		{name: "not allowed policy", object: group("team-a", miniov1alpha1.GroupSpec{Policies: []string{"consoleAdmin"}}), invalid: true},
+		{name: "no policies allowed", object: group("team-b", miniov1alpha1.GroupSpec{Policies: []string{"readonly"}}), invalid: true},
+		{name: "only policy resources", object: group("team-b", miniov1alpha1.GroupSpec{Members: []corev1.LocalObjectReference{{Name: "app"}}})},
+		{name: "policy added on update", old: group("team-a", miniov1alpha1.GroupSpec{}), object: group("team-a", miniov1alpha1.GroupSpec{Policies: []string{"readwrite"}}), invalid: true},
+		{name: "adopt allowed", object: adoptedGroup("team-a", "team-a-legacy")},
+		{name: "adopt of other namespace", object: adoptedGroup("team-a", "team-b-writers"), invalid: true},
+	})
+}
+
+func TestDefaulters(t *testing.T) {
+	user := &miniov1alpha1.User{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	if err := (&UserDefaulter{}).Default(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Spec.SecretName != "app-minio" || user.Spec.AccessKey == "" {
+		t.Errorf("user defaults not set: %+v", user.Spec)
+	}
+
+	key := &miniov1alpha1.AccessKey{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ci"}}
+	if err := (&AccessKeyDefaulter{}).Default(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if key.Spec.SecretName != key.SecretName() || key.Spec.SecretName == "" {
+		t.Errorf("access key defaults not set: %+v", key.Spec)
+	}
+
+	custom := &miniov1alpha1.AccessKey{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ci"}}
+	custom.Spec.SecretName = "ci-credentials"
+	if err := (&AccessKeyDefaulter{}).Default(context.Background(), custom); err != nil {
+		t.Fatal(err)
+	}
+	if custom.Spec.SecretName != "ci-credentials" {
+		t.Errorf("secret name overridden: %s", custom.Spec.SecretName)
+	}
+}
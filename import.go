@@ -0,0 +1,120 @@
+/*
+Copyright 2022 Aleksandr Baryshnikov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+	"github.com/reddec/minio-ext-operator/controllers"
+)
+
+// runImport prints resources for existing MinIO objects as multi-document YAML.
+func runImport(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	namespace := flags.String("namespace", "default", "Namespace of generated resources.")
+	dryRun := flags.Bool("dry-run", true,
+		"Annotate resources by "+miniov1alpha1.DryRunAnnotation+", so changes in MinIO are only planned till the annotation is removed.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := FromEnv()
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	minioClient, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.User, cfg.Password, ""),
+		Secure: cfg.Secure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return fmt.Errorf("create MinIO client: %w", err)
+	}
+	admin, err := madmin.New(cfg.Endpoint, cfg.User, cfg.Password, cfg.Secure)
+	if err != nil {
+		return fmt.Errorf("create MinIO admin client: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	importer := &controllers.Importer{
+		Admin:     admin,
+		Minio:     minioClient,
+		Namespace: *namespace,
+		DryRun:    *dryRun,
+	}
+	resources, notes, err := importer.Import(ctx)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	for _, note := range notes {
+		if _, err := fmt.Fprintln(out, "#", note); err != nil {
+			return err
+		}
+	}
+	for _, resource := range resources {
+		data, err := importedYAML(resource.Object)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", resource.Object.GetName(), err)
+		}
+		if _, err := fmt.Fprintln(out, "---"); err != nil {
+			return err
+		}
+		for _, note := range resource.Notes {
+			if _, err := fmt.Fprintln(out, "#", note); err != nil {
+				return err
+			}
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importedYAML encodes resource without status and empty server-side fields.
+func importedYAML(obj client.Object) ([]byte, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+	return yaml.Marshal(content)
+}
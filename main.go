@@ -17,8 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/minio/madmin-go"
@@ -29,14 +33,19 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	miniov1alpha1 "github.com/reddec/minio-ext-operator/api/v1alpha1"
+	miniov1beta1 "github.com/reddec/minio-ext-operator/api/v1beta1"
 	"github.com/reddec/minio-ext-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -50,32 +59,93 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(miniov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(miniov1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var policyNameTemplate string
+	var groupNameTemplate string
+	var userNameTemplate string
+	var secretNamespaces string
+	var configName string
+	var connectionName string
+	var namespaceSelector string
+	var enableWebhooks bool
+	var probeBucket string
+	var healthInterval time.Duration
+	var auditAddr string
+	var resync controllers.Resync
+	var pauseAll bool
+	var pauseConfigMap string
+	var dryRunAll bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&policyNameTemplate, "policy-name-template", controllers.DefaultPolicyNameTemplate,
+		"Go template for canned policy names in MinIO. Available fields: .Namespace, .Name")
+	flag.StringVar(&groupNameTemplate, "group-name-template", controllers.DefaultGroupNameTemplate,
+		"Go template for group names in MinIO. Available fields: .Namespace, .Name")
+	flag.StringVar(&userNameTemplate, "user-name-template", controllers.DefaultUserNameTemplate,
+		"Go template for user names (access keys) in MinIO if not set in spec. Available fields: .Namespace, .Name")
+	flag.StringVar(&secretNamespaces, "secret-target-namespaces", "",
+		"Comma-separated list of namespaces where copies of user secrets are allowed. Use * for all namespaces.")
+	flag.StringVar(&configName, "config-name", "",
+		"Name of OperatorConfig resource with namespace rules. If not set - rules are not enforced.")
+	flag.StringVar(&connectionName, "connection-name", "default",
+		"Name of MinIO connection used in namespace rules.")
+	flag.StringVar(&namespaceSelector, "watch-namespace-selector", "",
+		"Label selector of namespaces to watch in addition to WATCH_NAMESPACE (comma-separated list).")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable admission and conversion (v1beta1) webhooks. Requires certificates in /tmp/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&probeBucket, "health-probe-bucket", controllers.DefaultProbeBucket,
+		"Bucket checked for readiness. Bucket may not exist.")
+	flag.DurationVar(&healthInterval, "health-check-interval", 30*time.Second,
+		"Interval of MinIO connection checks for readiness.")
+	flag.StringVar(&auditAddr, "audit-bind-address", "0",
+		"The address of MinIO audit webhook endpoint ("+controllers.AuditPath+"). Set to 0 to disable.")
+	flag.DurationVar(&resync.Period, "resync-period", controllers.DefaultResyncPeriod,
+		"Period of checking resources in MinIO. Can be overridden by annotation "+miniov1alpha1.ResyncAnnotation+".")
+	flag.DurationVar(&resync.RetryPeriod, "retry-period", controllers.DefaultRetryPeriod,
+		"Delay before retry if dependency in MinIO is not ready yet (ex: user of policy).")
+	flag.BoolVar(&pauseAll, "paused", false,
+		"Pause changes in MinIO for all resources.")
+	flag.StringVar(&pauseConfigMap, "pause-configmap", "",
+		"ConfigMap (namespace/name) which pauses changes in MinIO for all resources if key "+controllers.PauseKey+" is \"true\".")
+	flag.BoolVar(&dryRunAll, "dry-run", false,
+		"Only plan changes in MinIO for all resources. Plan is saved in status of resources.")
 	opts := zap.Options{
 		Development: true,
 	}
-	namespace := os.Getenv("WATCH_NAMESPACE")
 
 	cfg, err := FromEnv()
 	if err != nil {
 		panic(err)
 	}
 
+	transport, err := minio.DefaultTransport(cfg.Secure)
+	if err != nil {
+		panic(err)
+	}
+
 	client, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.User, cfg.Password, ""),
-		Secure: cfg.Secure,
-		Region: cfg.Region,
+		Creds:     credentials.NewStaticV4(cfg.User, cfg.Password, ""),
+		Secure:    cfg.Secure,
+		Region:    cfg.Region,
+		Transport: controllers.InstrumentTransport(transport),
 	})
 	if err != nil {
 		panic(err)
@@ -85,78 +155,287 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	admin.SetCustomTransport(controllers.InstrumentTransport(madmin.DefaultTransport(cfg.Secure)))
 
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "144d0085.k8s.reddec.net",
-		Namespace:              namespace,
-		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
-		// when the Manager ends. This requires the binary to immediately end when the
-		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
-		// speeds up voluntary leader transitions as the new leader don't have to wait
-		// LeaseDuration time first.
-		//
-		// In the default scaffold provided, the program ends immediately after
-		// the manager stops, so would be fine to enable this option. However,
-		// if you are doing or is intended to do any operation such as perform cleanups
-		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
-	})
+	policyName, err := controllers.ParseNameTemplate(policyNameTemplate)
 	if err != nil {
-		setupLog.Error(err, "unable to start manager")
+		setupLog.Error(err, "invalid policy name template")
 		os.Exit(1)
 	}
-
-	if err = (&controllers.UserReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Admin:  admin,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "User")
+	groupName, err := controllers.ParseNameTemplate(groupNameTemplate)
+	if err != nil {
+		setupLog.Error(err, "invalid group name template")
 		os.Exit(1)
 	}
-	if err = (&controllers.BucketReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Minio:  client,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Bucket")
+	userName, err := controllers.ParseNameTemplate(userNameTemplate)
+	if err != nil {
+		setupLog.Error(err, "invalid user name template")
 		os.Exit(1)
 	}
-	if err = (&controllers.PolicyReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Admin:  admin,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Policy")
+
+	pauseKey, err := parseObjectKey(pauseConfigMap)
+	if err != nil {
+		setupLog.Error(err, "invalid pause config map")
 		os.Exit(1)
 	}
-	//+kubebuilder:scaffold:builder
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+	watchNamespaces := splitList(os.Getenv("WATCH_NAMESPACE"))
+	var selector labels.Selector
+	if namespaceSelector != "" {
+		selector, err = labels.Parse(namespaceSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid namespace selector")
+			os.Exit(1)
+		}
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+
+	run := func(ctx context.Context) error {
+		options := ctrl.Options{
+			Scheme:                 scheme,
+			MetricsBindAddress:     metricsAddr,
+			Port:                   9443,
+			HealthProbeBindAddress: probeAddr,
+			LeaderElection:         enableLeaderElection,
+			LeaderElectionID:       "144d0085.k8s.reddec.net",
+			// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
+			// when the Manager ends. This requires the binary to immediately end when the
+			// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
+			// speeds up voluntary leader transitions as the new leader don't have to wait
+			// LeaseDuration time first.
+			//
+			// In the default scaffold provided, the program ends immediately after
+			// the manager stops, so would be fine to enable this option. However,
+			// if you are doing or is intended to do any operation such as perform cleanups
+			// after the manager stops then its usage might be unsafe.
+			// LeaderElectionReleaseOnCancel: true,
+		}
+		// namespaces matched by selector may change, so all namespaces are watched and filtered by scope
+		switch {
+		case selector != nil || len(watchNamespaces) == 0:
+			// all namespaces
+		case len(watchNamespaces) == 1:
+			options.Namespace = watchNamespaces[0]
+		default:
+			options.NewCache = cache.MultiNamespacedCacheBuilder(watchNamespaces)
+		}
+		mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
+		if err != nil {
+			return fmt.Errorf("create manager: %w", err)
+		}
+
+		var scope *controllers.Scope
+		if selector != nil {
+			scope = &controllers.Scope{
+				Static:   watchNamespaces,
+				Selector: selector,
+				Reader:   mgr.GetAPIReader(),
+				Interval: controllers.DefaultScopeInterval,
+			}
+			if err := scope.Refresh(ctx); err != nil {
+				return fmt.Errorf("resolve namespaces: %w", err)
+			}
+			if err := mgr.Add(scope); err != nil {
+				return fmt.Errorf("set up namespaces scope: %w", err)
+			}
+			setupLog.Info("watching namespaces", "namespaces", scope.Namespaces(), "selector", namespaceSelector)
+		}
+
+		// changes in MinIO reported by audit webhook are enqueued to reconcilers
+		audit := controllers.NewAuditReceiver(mgr.GetClient(), auditAddr)
+		audit.Token = cfg.AuditToken
+		audit.IgnoreAccessKey = cfg.User
+		if auditAddr != "0" {
+			// webhook triggers calls to MinIO, so unauthenticated requests are not accepted
+			if audit.Token == "" {
+				return fmt.Errorf("set MINIO_AUDIT_TOKEN: %w", controllers.ErrAuditToken)
+			}
+			if err := mgr.Add(audit); err != nil {
+				return fmt.Errorf("set up audit webhook: %w", err)
+			}
+		}
+
+		pause := &controllers.Pause{
+			All:       pauseAll,
+			ConfigMap: pauseKey,
+			Reader:    mgr.GetAPIReader(),
+		}
+		dryRun := &controllers.DryRun{
+			All:      dryRunAll,
+			Recorder: mgr.GetEventRecorderFor("dry-run"),
+		}
+		// reconcilers use clients which only plan changes in dry-run mode
+		plannedAdmin := controllers.NewPlannedAdmin(admin)
+		plannedS3 := controllers.NewPlannedS3(client)
+
+		var authorizer *controllers.Authorizer
+		if configName != "" {
+			authorizer = &controllers.Authorizer{
+				Reader:     mgr.GetAPIReader(),
+				ConfigName: configName,
+				Connection: connectionName,
+			}
+		}
+
+		if err = (&controllers.UserReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Admin:    plannedAdmin,
+			Recorder: mgr.GetEventRecorderFor("user-controller"),
+			Connection: controllers.Connection{
+				Endpoint: cfg.Endpoint,
+				Region:   cfg.Region,
+				Secure:   cfg.Secure,
+			},
+			UserName:         userName,
+			APIReader:        mgr.GetAPIReader(),
+			SecretNamespaces: splitList(secretNamespaces),
+			Authorizer:       authorizer,
+			Resync:           resync,
+			Pause:            pause,
+			DryRun:           dryRun,
+			Scope:            scope,
+			Events:           audit.Users,
+		}).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("create User controller: %w", err)
+		}
+		if err = (&controllers.BucketReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			Minio:      plannedS3,
+			Recorder:   mgr.GetEventRecorderFor("bucket-controller"),
+			Authorizer: authorizer,
+			Resync:     resync,
+			Pause:      pause,
+			DryRun:     dryRun,
+			Scope:      scope,
+			Events:     audit.Buckets,
+		}).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("create Bucket controller: %w", err)
+		}
+		if err = (&controllers.PolicyReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			Admin:      plannedAdmin,
+			PolicyName: policyName,
+			Recorder:   mgr.GetEventRecorderFor("policy-controller"),
+			Authorizer: authorizer,
+			Resync:     resync,
+			Pause:      pause,
+			DryRun:     dryRun,
+			Scope:      scope,
+			Events:     audit.Policies,
+		}).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("create Policy controller: %w", err)
+		}
+		if err = (&controllers.GroupReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			Admin:      plannedAdmin,
+			GroupName:  groupName,
+			Authorizer: authorizer,
+			Resync:     resync,
+			Pause:      pause,
+			DryRun:     dryRun,
+			Scope:      scope,
+		}).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("create Group controller: %w", err)
+		}
+		if err = (&controllers.AccessKeyReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			Admin:      plannedAdmin,
+			Authorizer: authorizer,
+			Resync:     resync,
+			Pause:      pause,
+			DryRun:     dryRun,
+			Scope:      scope,
+		}).SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("create AccessKey controller: %w", err)
+		}
+		if enableWebhooks {
+			if err = (&controllers.BucketValidator{Authorizer: authorizer}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create Bucket webhook: %w", err)
+			}
+			if err = (&controllers.UserDefaulter{UserName: userName}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create User webhook: %w", err)
+			}
+			if err = (&controllers.UserValidator{Authorizer: authorizer, Reader: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create User webhook: %w", err)
+			}
+			if err = (&controllers.PolicyValidator{Authorizer: authorizer}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create Policy webhook: %w", err)
+			}
+			if err = (&controllers.GroupValidator{Authorizer: authorizer}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create Group webhook: %w", err)
+			}
+			if err = (&controllers.AccessKeyDefaulter{}).SetupWebhookWithManager(mgr); err != nil {
+				return fmt.Errorf("create AccessKey webhook: %w", err)
+			}
+		}
+		//+kubebuilder:scaffold:builder
+
+		collector := &controllers.ResourceCollector{Reader: mgr.GetClient(), Admin: admin}
+		if err := metrics.Registry.Register(collector); err != nil {
+			return fmt.Errorf("register metrics collector: %w", err)
+		}
+		defer metrics.Registry.Unregister(collector)
+
+		if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+			return fmt.Errorf("set up health check: %w", err)
+		}
+		if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+			return fmt.Errorf("set up ready check: %w", err)
+		}
+		// each connection has own check, available as /readyz/minio-<connection>
+		checker := &controllers.HealthChecker{
+			Connection:  connectionName,
+			Admin:       admin,
+			Minio:       client,
+			ProbeBucket: probeBucket,
+			Interval:    healthInterval,
+		}
+		if err := mgr.Add(checker); err != nil {
+			return fmt.Errorf("set up connection check: %w", err)
+		}
+		if err := mgr.AddReadyzCheck("minio-"+connectionName, checker.Check); err != nil {
+			return fmt.Errorf("set up ready check: %w", err)
+		}
+
+		setupLog.Info("starting manager")
+		return mgr.Start(ctx)
 	}
 
-	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := run(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+}
 
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseObjectKey parses namespace/name. Empty value gives empty key.
+func parseObjectKey(value string) (types.NamespacedName, error) {
+	if value == "" {
+		return types.NamespacedName{}, nil
+	}
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q should be in namespace/name format", value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
 }
 
 func FromEnv() (*Config, error) {
@@ -170,4 +449,6 @@ type Config struct {
 	Password string `required:"true" envconfig:"PASSWORD"`
 	Region   string `required:"true" envconfig:"REGION"`
 	Secure   bool   `envconfig:"SECURE"`
+	// Expected auth_token of MinIO audit webhook. Required if audit webhook is enabled.
+	AuditToken string `envconfig:"AUDIT_TOKEN"`
 }